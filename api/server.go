@@ -0,0 +1,117 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ind9/vasuki/metrics"
+	"github.com/ind9/vasuki/pool"
+	"github.com/ind9/vasuki/utils/logging"
+)
+
+// Server - HTTP API to look into and control the pools of a running Vasuki instance
+//
+//	GET  /pools                   Status of every pool
+//	GET  /pools/<name>            Status of the pool
+//	POST /pools/<name>/pause      Stops scaling the pool
+//	POST /pools/<name>/resume     Resumes scaling the pool
+//	POST /pools/<name>/reconcile  Reconciles the pool right away
+//	GET  /metrics                 Metrics of every pool in the Prometheus text format
+type Server struct {
+	pools []*pool.Pool
+}
+
+// NewServer - Creates a new api.Server instance for the pools
+func NewServer(pools []*pool.Pool) *Server {
+	return &Server{pools: pools}
+}
+
+// Handler - http.Handler serving the API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pools", s.listPools)
+	mux.HandleFunc("/pools/", s.poolAction)
+	mux.Handle("/metrics", metrics.Handler())
+	return mux
+}
+
+func (s *Server) listPools(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "only GET is supported")
+		return
+	}
+	statuses := []pool.Status{}
+	for _, p := range s.pools {
+		statuses = append(statuses, p.Status())
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (s *Server) poolAction(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/pools/"), "/"), "/")
+	p := s.find(parts[0])
+	if p == nil {
+		writeError(w, http.StatusNotFound, "pool "+parts[0]+" not found")
+		return
+	}
+
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "only GET is supported")
+			return
+		}
+		writeJSON(w, http.StatusOK, p.Status())
+		return
+	}
+
+	if len(parts) != 2 {
+		writeError(w, http.StatusNotFound, "unknown path "+r.URL.Path)
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "only POST is supported")
+		return
+	}
+	switch parts[1] {
+	case "pause":
+		logging.Log.Infof("[%s] Pausing pool on request", p.Name())
+		p.Pause()
+	case "resume":
+		logging.Log.Infof("[%s] Resuming pool on request", p.Name())
+		p.Resume()
+	case "reconcile":
+		if p.Paused() {
+			// A paused pool doesn't reconcile, the trigger would be silently dropped
+			writeError(w, http.StatusConflict, fmt.Sprintf("pool %s is paused, resume it to reconcile", p.Name()))
+			return
+		}
+		p.Trigger()
+	default:
+		writeError(w, http.StatusNotFound, "unknown action "+parts[1])
+		return
+	}
+	writeJSON(w, http.StatusAccepted, p.Status())
+}
+
+func (s *Server) find(name string) *pool.Pool {
+	for _, p := range s.pools {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logging.Log.Warningf("Failed to write the API response: %s", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ind9/vasuki/executor"
+	"github.com/ind9/vasuki/pool"
+	"github.com/ind9/vasuki/scalar"
+	"github.com/ind9/vasuki/utils/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func init() {
+	logging.MuteLogs()
+	executor.Register("api-test", func() executor.Executor {
+		mockExecutor := new(executor.MockExecutor)
+		mockExecutor.On("Init", mock.Anything).Return(nil)
+		mockExecutor.On("ManagedAgents").Return([]string{"agent-1"}, nil)
+		return mockExecutor
+	})
+}
+
+func newTestServer(t *testing.T) *httptest.Server {
+	p, err := pool.New(&pool.Config{
+		Name:           "ft",
+		PollInterval:   time.Minute,
+		Scalar:         scalar.NewConfig([]string{"FT"}, []string{}, 2),
+		Executor:       "api-test",
+		ExecutorConfig: &executor.Config{Additional: map[string]string{}},
+	}, nil)
+	assert.NoError(t, err)
+	return httptest.NewServer(NewServer([]*pool.Pool{p}).Handler())
+}
+
+func TestListPools(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/pools")
+	assert.NoError(t, err)
+	defer response.Body.Close()
+
+	var statuses []map[string]interface{}
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&statuses))
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, "ft", statuses[0]["name"])
+	assert.Equal(t, []interface{}{"agent-1"}, statuses[0]["managed-agents"])
+	assert.Contains(t, statuses[0], "demand")
+}
+
+func TestPauseAndResumeAPool(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	response, err := http.Post(server.URL+"/pools/ft/pause", "application/json", nil)
+	assert.NoError(t, err)
+	var status pool.Status
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&status))
+	response.Body.Close()
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+	assert.True(t, status.Paused)
+
+	response, err = http.Post(server.URL+"/pools/ft/resume", "application/json", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&status))
+	response.Body.Close()
+	assert.False(t, status.Paused)
+}
+
+func TestUnknownPoolsAndActions(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/pools/uat")
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	response, err = http.Post(server.URL+"/pools/ft/scale", "application/json", nil)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	response, err = http.Get(server.URL + "/pools/ft/reconcile")
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, response.StatusCode)
+}
+
+func TestReconcileAPausedPoolIsAConflict(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	response, err := http.Post(server.URL+"/pools/ft/pause", "application/json", nil)
+	assert.NoError(t, err)
+	response.Body.Close()
+
+	response, err = http.Post(server.URL+"/pools/ft/reconcile", "application/json", nil)
+	assert.NoError(t, err)
+	var body map[string]string
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&body))
+	response.Body.Close()
+	assert.Equal(t, http.StatusConflict, response.StatusCode)
+	assert.Contains(t, body["error"], "paused")
+
+	response, err = http.Post(server.URL+"/pools/ft/resume", "application/json", nil)
+	assert.NoError(t, err)
+	response.Body.Close()
+	response, err = http.Post(server.URL+"/pools/ft/reconcile", "application/json", nil)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+}
@@ -2,80 +2,281 @@ package main
 
 import (
 	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/ashwanthkumar/go-gocd"
+	"github.com/ind9/vasuki/api"
+	"github.com/ind9/vasuki/config"
 	"github.com/ind9/vasuki/executor"
 	_ "github.com/ind9/vasuki/executor/docker"
+	_ "github.com/ind9/vasuki/executor/kubernetes"
+	"github.com/ind9/vasuki/metrics"
+	"github.com/ind9/vasuki/pool"
 	"github.com/ind9/vasuki/scalar"
 	"github.com/ind9/vasuki/utils/logging"
+	"github.com/ind9/vasuki/utils/sets"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var goServerPort int
 var goServerHost string
 var pollInterval time.Duration
+var maxBackoff time.Duration
 var env []string
 var resources []string
 var maxAgents int
+var minAgents int
+var scalingPolicy string
+var scalingStep int
+var scalingFactor float64
+var scaleUpCooldown time.Duration
+var scaleDownCooldown time.Duration
+var minIdleTime time.Duration
+var registrationTimeout time.Duration
+var gcInterval time.Duration
+var maxLifetime time.Duration
+var ephemeral bool
 var autoRegisterKey string
 var username string
 var password string
+var poolSpecs []string
 
-// docker settings
-var dockerImage string
-var dockerEndpoint string
-var dockerSettingsFromEnv bool
+// executor settings
+var executorName string
+var executorOptions = make(map[string]map[string]*string)
+var executorSwitches = make(map[string]map[string]*bool)
 
 // misc
 var verboseMode bool
+var configFile string
+var httpAddr string
+var dryRun bool
+var drainOnExit bool
+var drainTimeout time.Duration
 
 var vasukiCommand = &cobra.Command{
 	Use:   "vasuki",
 	Short: "Scale GoCD Agents on demand",
 	Long:  `Scale GoCD Agents on demand`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if configFile != "" {
+			file, err := config.Load(configFile)
+			handleError(cmd, err)
+			err = applyConfigFile(cmd.Flags(), file)
+			handleError(cmd, err)
+		}
 		logging.EnableDebug(verboseMode)
-		logging.Log.Infof("Starting Vasuki instance with Env=%v, Resources=%v", env, resources)
 		ServerHost := fmt.Sprintf("http://%s:%d", goServerHost, goServerPort)
+		client := metrics.InstrumentClient(gocd.New(ServerHost, username, password))
 
-		executorAdditionalConfig := make(map[string]string)
-		executorAdditionalConfig["DOCKER_IMAGE"] = dockerImage
-		executorAdditionalConfig["DOCKER_ENDPOINT"] = dockerEndpoint
-		executorAdditionalConfig["DOCKER_FROM_ENV"] = fmt.Sprintf("%t", dockerSettingsFromEnv)
-
-		executorConfig := &executor.Config{
-			ServerHost:      goServerHost,
-			ServerPort:      goServerPort,
-			AutoRegisterKey: autoRegisterKey,
-			Env:             env,
-			Resources:       resources,
-			Additional:      executorAdditionalConfig,
+		poolConfigs, err := poolConfigs()
+		handleError(cmd, err)
+		var pools []*pool.Pool
+		for _, poolConfig := range poolConfigs {
+			p, err := pool.New(poolConfig, client)
+			handleError(cmd, err)
+			pools = append(pools, p)
 		}
-		executor.DefaultExecutor.Init(executorConfig)
 
-		scalar, err := scalar.NewSimpleScalar(env, resources, maxAgents, gocd.New(ServerHost, username, password))
-		if err != nil {
-			handleError(cmd, err)
+		if httpAddr != "" {
+			serveAPI(cmd, pools)
 		}
 
-		doWork(scalar, cmd)
-		c := time.Tick(pollInterval)
-		for {
-			select {
-			case <-c:
-				doWork(scalar, cmd)
-			}
+		if dryRun {
+			logging.Log.Warning("Running in dry run mode, agents won't be scaled")
 		}
+		logging.Log.Infof("Starting Vasuki instance with %d pool(s)", len(pools))
+		runPools(cmd, pools)
 	},
 }
 
-func doWork(scalarImpl scalar.Scalar, cmd *cobra.Command) {
-	err := scalar.Execute(scalarImpl)
+// runPools - Runs every pool on its own until all of them have stopped, or until Vasuki is asked
+// to shut down with SIGTERM / SIGINT. In-flight reconciles are finished before the pools stop, a
+// second signal exits right away.
+func runPools(cmd *cobra.Command, pools []*pool.Pool) {
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		// The default handling is restored, so a second signal can abort the shutdown or the drain
+		signal.Stop(signals)
+		logging.Log.Infof("Received %s, stopping the pools. Send it again to exit right away", sig)
+		close(stop)
+	}()
+
+	errs := make(chan error, len(pools))
+	for _, p := range pools {
+		go func(p *pool.Pool) {
+			errs <- p.Run(stop)
+		}(p)
+	}
+
+	var failed bool
+	for range pools {
+		if err := <-errs; err != nil {
+			logging.Log.Criticalf("[Error] %s", err.Error())
+			failed = true
+		}
+	}
+	if drainOnExit {
+		failed = drainPools(pools) || failed
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// drainPools - Drains every pool in parallel, returns true if any of them failed to
+func drainPools(pools []*pool.Pool) bool {
+	errs := make(chan error, len(pools))
+	for _, p := range pools {
+		go func(p *pool.Pool) {
+			errs <- p.Drain(drainTimeout)
+		}(p)
+	}
+
+	var failed bool
+	for range pools {
+		if err := <-errs; err != nil {
+			logging.Log.Criticalf("[Error] %s", err.Error())
+			failed = true
+		}
+	}
+	return failed
+}
+
+// serveAPI - Serves the HTTP API of the pools on --http-addr in the background
+func serveAPI(cmd *cobra.Command, pools []*pool.Pool) {
+	listener, err := net.Listen("tcp", httpAddr)
 	handleError(cmd, err)
+	logging.Log.Infof("Serving the HTTP API on %s", listener.Addr())
+	go func() {
+		err := http.Serve(listener, api.NewServer(pools).Handler())
+		logging.Log.Criticalf("[Error] HTTP API stopped: %s", err)
+	}()
+}
+
+// poolConfigs - Pools defined in the config file and via --pool, or a single "default" pool made of the agent flags
+func poolConfigs() ([]*pool.Config, error) {
+	if len(filePools) == 0 && len(poolSpecs) == 0 {
+		config := defaultPoolConfig("")
+		config.Name = "default"
+		return []*pool.Config{config}, nil
+	}
+
+	var configs []*pool.Config
+	for _, filePool := range filePools {
+		var preceding []*scalar.Config
+		var shared *scalar.SharedMaxAgents
+		if len(filePool.Profiles) > 0 {
+			// The profiles share the max agents of the pool, along with any other setting they don't override
+			config, err := pool.FromSettings(filePool.Name, withFlagOverrides(filePool.Settings()), defaultPoolConfig)
+			if err != nil {
+				return nil, err
+			}
+			shared = scalar.NewSharedMaxAgents(config.Scalar.MaxAgents)
+		}
+		for _, profile := range filePool.Expand() {
+			config, err := pool.FromSettings(profile.Name, withFlagOverrides(profile.Settings()), defaultPoolConfig)
+			if err != nil {
+				return nil, err
+			}
+			// A job that more than one profile can run is only demand of the first of them
+			config.Scalar.Preceding = preceding
+			config.Scalar.Shared = shared
+			preceding = append(preceding, config.Scalar)
+			configs = append(configs, config)
+		}
+	}
+	for _, spec := range poolSpecs {
+		config, err := pool.ParseSpec(spec, defaultPoolConfig)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, config)
+	}
+
+	names := sets.Empty()
+	for _, config := range configs {
+		if names.Contains(config.Name) {
+			return nil, fmt.Errorf("Pool %s is defined more than once", config.Name)
+		}
+		names.Add(config.Name)
+		// --dry-run is for trialling pools safely, so none of them get to scale for real
+		config.Scalar.DryRun = config.Scalar.DryRun || dryRun
+	}
+	return configs, nil
+}
+
+// defaultPoolConfig - Pool settings from the flags, for the given executor or --executor when empty
+func defaultPoolConfig(name string) *pool.Config {
+	if name == "" {
+		name = executorName
+	}
+	scalarConfig := scalar.NewConfig(env, resources, maxAgents)
+	scalarConfig.MinAgents = minAgents
+	scalarConfig.ScaleUpCooldown = scaleUpCooldown
+	scalarConfig.ScaleDownCooldown = scaleDownCooldown
+	scalarConfig.MinIdleTime = minIdleTime
+	scalarConfig.RegistrationTimeout = registrationTimeout
+	scalarConfig.GarbageCollectionInterval = gcInterval
+	scalarConfig.MaxLifetime = maxLifetime
+	scalarConfig.Ephemeral = ephemeral
+	scalarConfig.DryRun = dryRun
+	return &pool.Config{
+		PollInterval:  pollInterval,
+		MaxBackoff:    maxBackoff,
+		Scalar:        scalarConfig,
+		ScalingPolicy: scalingPolicy,
+		ScalingStep:   scalingStep,
+		ScalingFactor: scalingFactor,
+		Executor:      name,
+		ExecutorConfig: &executor.Config{
+			ServerHost:      goServerHost,
+			ServerPort:      goServerPort,
+			AutoRegisterKey: autoRegisterKey,
+			Additional:      executorAdditionalConfig(name),
+		},
+	}
+}
+
+// executorAdditionalConfig - Values of the namespaced flags of the executor keyed by the option name
+func executorAdditionalConfig(name string) map[string]string {
+	additional := make(map[string]string)
+	for option, value := range executorOptions[name] {
+		additional[option] = *value
+	}
+	for option, value := range executorSwitches[name] {
+		additional[option] = fmt.Sprintf("%t", *value)
+	}
+	return additional
+}
+
+// registerExecutorFlags - Exposes the options of every registered executor as `--<executor>-<option>` flags
+func registerExecutorFlags(flags *pflag.FlagSet) {
+	for _, name := range executor.Names() {
+		executorOptions[name] = make(map[string]*string)
+		executorSwitches[name] = make(map[string]*bool)
+		for _, option := range executor.Options(name) {
+			flagName := fmt.Sprintf("%s-%s", name, option.Name)
+			if option.Boolean {
+				executorSwitches[name][option.Name] = flags.Bool(flagName, option.Default == "true", option.Usage)
+			} else {
+				executorOptions[name][option.Name] = flags.String(flagName, option.Default, option.Usage)
+			}
+		}
+	}
 }
 
+// handleError - Exits on startup / configuration errors, errors of the reconcile loop are handled by each pool
 func handleError(cmd *cobra.Command, err error) {
 	if err != nil {
 		logging.Log.Criticalf("[Error] %s", err.Error())
@@ -88,7 +289,19 @@ func init() {
 	vasukiCommand.PersistentFlags().StringSliceVar(&env, "agent-env", []string{}, "List of environments for the go-agent")
 	vasukiCommand.PersistentFlags().StringSliceVar(&resources, "agent-resources", []string{}, "List of resources for the go-agent")
 	vasukiCommand.PersistentFlags().IntVar(&maxAgents, "agent-max-count", 1, "Maximum number of agents managed by this Vasuki instance")
+	vasukiCommand.PersistentFlags().IntVar(&minAgents, "agent-min-count", 0, "Number of idle agents that are always kept ready on top of the demand (warm pool)")
+	vasukiCommand.PersistentFlags().StringVar(&scalingPolicy, "agent-scaling-policy", "half-step", "Policy deciding how many agents to scale by. One of half-step, all-at-once, fixed-step, proportional")
+	vasukiCommand.PersistentFlags().IntVar(&scalingStep, "agent-scaling-step", 1, "Number of agents to scale by at a time with the fixed-step scaling policy")
+	vasukiCommand.PersistentFlags().Float64Var(&scalingFactor, "agent-scaling-factor", 0.5, "Fraction of the difference between demand and supply to scale by with the proportional scaling policy")
+	vasukiCommand.PersistentFlags().DurationVar(&scaleUpCooldown, "agent-scale-up-cooldown", 0, "Minimum time between two scale ups")
+	vasukiCommand.PersistentFlags().DurationVar(&scaleDownCooldown, "agent-scale-down-cooldown", 0, "Minimum time since the last scale up or down before scaling down")
+	vasukiCommand.PersistentFlags().DurationVar(&minIdleTime, "agent-min-idle-time", 0, "Minimum time an agent has to be idle before it can be scaled down")
+	vasukiCommand.PersistentFlags().DurationVar(&registrationTimeout, "agent-registration-timeout", 0, "Time an agent gets to register with the Go Server before it's killed and replaced. Disabled when 0")
+	vasukiCommand.PersistentFlags().DurationVar(&gcInterval, "agent-gc-interval", 10*time.Minute, "How often agents left behind by the executor (e.g. exited containers) are removed along with their records on the Go Server. Disabled when 0")
+	vasukiCommand.PersistentFlags().DurationVar(&maxLifetime, "agent-max-lifetime", 0, "Age after which an idle agent is replaced by a new one, so it doesn't pile up disk, caches and processes. Disabled when 0")
+	vasukiCommand.PersistentFlags().BoolVar(&ephemeral, "agent-ephemeral", false, "Run a single job on every agent, after which it's disabled, deleted and killed instead of being reused")
 	vasukiCommand.PersistentFlags().StringVar(&autoRegisterKey, "agent-auto-register-key", "123456ABCDEFG", "AutoRegisterKey for the agent to register to the GoCD Server")
+	vasukiCommand.PersistentFlags().StringArrayVar(&poolSpecs, "pool", []string{}, "Pool of agents managed by this instance, as <name>:env=FT;resources=FT,chrome;max-agents=3;executor=docker;image=gocd-agent. Settings left out default to the agent / executor flags. Can be repeated")
 
 	// GoCD Server related flags
 	vasukiCommand.PersistentFlags().StringVar(&goServerHost, "server-host", "localhost", "Go Server Domain / IP Address")
@@ -96,12 +309,17 @@ func init() {
 	vasukiCommand.PersistentFlags().StringVar(&username, "server-username", "", "Username to connect to Go Server")
 	vasukiCommand.PersistentFlags().StringVar(&password, "server-password", "", "Password of the User to connect to Go Server")
 	vasukiCommand.PersistentFlags().DurationVar(&pollInterval, "server-poll-interval", 30*time.Second, "Poll interval for new scheduled jobs")
+	vasukiCommand.PersistentFlags().DurationVar(&maxBackoff, "server-max-backoff", 5*time.Minute, "Maximum delay between retries when a pool keeps failing to reconcile")
 
-	// docker related flags
-	vasukiCommand.PersistentFlags().StringVar(&dockerImage, "docker-image", "ashwanthkumar/gocd-agent", "Docker image used for spinning up the agent")
-	vasukiCommand.PersistentFlags().StringVar(&dockerEndpoint, "docker-endpoint", "unix:///var/run/docker.sock", "Docker endpoint to connect to")
-	vasukiCommand.PersistentFlags().BoolVar(&dockerSettingsFromEnv, "docker-env", false, "Flag to pick up docker settings from Env. Useful when working with boot2docker / docker-machine")
+	// executor related flags
+	vasukiCommand.PersistentFlags().StringVar(&executorName, "executor", "docker", fmt.Sprintf("Executor used for spinning up the agents. One of %s", strings.Join(executor.Names(), ", ")))
+	registerExecutorFlags(vasukiCommand.PersistentFlags())
 
 	// misc flags
+	vasukiCommand.PersistentFlags().StringVar(&configFile, "config", "", "YAML / JSON file with the Vasuki configuration. Flags given on the command line override its values")
+	vasukiCommand.PersistentFlags().StringVar(&httpAddr, "http-addr", "", "Address to serve the HTTP status and control API on, e.g. :8080. Disabled when empty")
+	vasukiCommand.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Only log the agents that would be started and the ones that would be disabled, deleted and killed, without doing so")
+	vasukiCommand.PersistentFlags().BoolVar(&drainOnExit, "drain-on-exit", false, "On SIGTERM / SIGINT, remove every managed agent once it's done building before exiting")
+	vasukiCommand.PersistentFlags().DurationVar(&drainTimeout, "drain-timeout", 10*time.Minute, "Maximum time to wait for agents to finish building with --drain-on-exit. Agents still building are left running")
 	vasukiCommand.PersistentFlags().BoolVar(&verboseMode, "verbose", false, "Enable verbose logging")
 }
@@ -0,0 +1,406 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/ind9/vasuki/executor"
+	"github.com/ind9/vasuki/scalar"
+	"github.com/ind9/vasuki/utils/sets"
+	"gopkg.in/yaml.v2"
+)
+
+// File - Vasuki configuration read via --config. JSON files are picked by their .json
+// extension, everything else is read as YAML.
+type File struct {
+	Server    Server                       `yaml:"server" json:"server"`
+	Agent     Agent                        `yaml:"agent" json:"agent"`
+	Executor  string                       `yaml:"executor" json:"executor"`
+	Executors map[string]map[string]string `yaml:"executors" json:"executors"` // Default options of each executor
+	Pools     []*Pool                      `yaml:"pools" json:"pools"`
+	HTTPAddr  string                       `yaml:"http-addr" json:"http-addr"`
+	DryRun    bool                         `yaml:"dry-run" json:"dry-run"`
+	Drain     Drain                        `yaml:"drain" json:"drain"`
+	Verbose   bool                         `yaml:"verbose" json:"verbose"`
+}
+
+// Server - GoCD Server settings
+type Server struct {
+	Host         string `yaml:"host" json:"host"`
+	Port         int    `yaml:"port" json:"port"`
+	Username     string `yaml:"username" json:"username"`
+	Password     string `yaml:"password" json:"password"`
+	PollInterval string `yaml:"poll-interval" json:"poll-interval"`
+	MaxBackoff   string `yaml:"max-backoff" json:"max-backoff"`
+}
+
+// Drain - Removal of the managed agents when Vasuki shuts down
+type Drain struct {
+	OnExit  bool   `yaml:"on-exit" json:"on-exit"`
+	Timeout string `yaml:"timeout" json:"timeout"`
+}
+
+// Agent - Defaults for the agents of every pool
+type Agent struct {
+	Env                 []string `yaml:"env" json:"env"`
+	Resources           []string `yaml:"resources" json:"resources"`
+	MaxAgents           int      `yaml:"max-agents" json:"max-agents"`
+	MinAgents           int      `yaml:"min-agents" json:"min-agents"`
+	AutoRegisterKey     string   `yaml:"auto-register-key" json:"auto-register-key"`
+	RegistrationTimeout string   `yaml:"registration-timeout" json:"registration-timeout"`
+	GCInterval          string   `yaml:"gc-interval" json:"gc-interval"`
+	MaxLifetime         string   `yaml:"max-lifetime" json:"max-lifetime"`
+	Ephemeral           bool     `yaml:"ephemeral" json:"ephemeral"`
+	Scaling             `yaml:",inline"`
+}
+
+// Scaling - Scaling policy and its parameters (see scalar.NewScalingPolicy), along with the cooldowns
+type Scaling struct {
+	Policy            string  `yaml:"scaling-policy" json:"scaling-policy"`
+	Step              int     `yaml:"scaling-step" json:"scaling-step"`
+	Factor            float64 `yaml:"scaling-factor" json:"scaling-factor"`
+	ScaleUpCooldown   string  `yaml:"scale-up-cooldown" json:"scale-up-cooldown"`
+	ScaleDownCooldown string  `yaml:"scale-down-cooldown" json:"scale-down-cooldown"`
+	MinIdleTime       string  `yaml:"min-idle-time" json:"min-idle-time"`
+}
+
+// Pool - Settings of a single pool. Maps onto scalar.Config and executor.Config,
+// Additional holds the options of the pool's executor.
+type Pool struct {
+	Name                string            `yaml:"name" json:"name"`
+	Env                 []string          `yaml:"env" json:"env"`
+	Resources           []string          `yaml:"resources" json:"resources"`
+	MaxAgents           int               `yaml:"max-agents" json:"max-agents"`
+	MinAgents           int               `yaml:"min-agents" json:"min-agents"`
+	PollInterval        string            `yaml:"poll-interval" json:"poll-interval"`
+	Executor            string            `yaml:"executor" json:"executor"`
+	Additional          map[string]string `yaml:"additional" json:"additional"`
+	RegistrationTimeout string            `yaml:"registration-timeout" json:"registration-timeout"`
+	GCInterval          string            `yaml:"gc-interval" json:"gc-interval"`
+	MaxLifetime         string            `yaml:"max-lifetime" json:"max-lifetime"`
+	Ephemeral           bool              `yaml:"ephemeral" json:"ephemeral"`
+	DryRun              bool              `yaml:"dry-run" json:"dry-run"`
+	Profiles            []*Profile        `yaml:"profiles" json:"profiles"`
+	Scaling             `yaml:",inline"`
+}
+
+// Profile - Agents of a pool that are launched for the jobs needing a particular image or container
+// settings. Each profile is scaled as a pool of its own, named <pool>-<profile>, and the max-agents
+// of the pool is shared by all its profiles.
+type Profile struct {
+	Name string `yaml:"name" json:"name"`
+	// Replaces the env of the pool when given
+	Env []string `yaml:"env" json:"env"`
+	// Added to the resources of the pool
+	Resources  []string          `yaml:"resources" json:"resources"`
+	MaxAgents  int               `yaml:"max-agents" json:"max-agents"`
+	MinAgents  int               `yaml:"min-agents" json:"min-agents"`
+	Additional map[string]string `yaml:"additional" json:"additional"` // Override the options of the pool's executor
+}
+
+// Load - Reads and validates the configuration file
+func Load(path string) (*File, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &File{}
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(file)
+	} else {
+		err = yaml.UnmarshalStrict(content, file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid config file %s: %s", path, err)
+	}
+
+	if err = file.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid config file %s: %s", path, err)
+	}
+	return file, nil
+}
+
+// Validate - Checks every field of the configuration and reports all the invalid ones
+func (f *File) Validate() error {
+	var resultErr *multierror.Error
+
+	if f.Server.Port != 0 && (f.Server.Port < 1 || f.Server.Port > 65535) {
+		resultErr = invalid(resultErr, "server.port", "must be between 1 and 65535")
+	}
+	resultErr = validateDuration(resultErr, "server.poll-interval", f.Server.PollInterval)
+	resultErr = validateDuration(resultErr, "server.max-backoff", f.Server.MaxBackoff)
+	resultErr = validateDuration(resultErr, "drain.timeout", f.Drain.Timeout)
+	if f.Agent.MaxAgents < 0 {
+		resultErr = invalid(resultErr, "agent.max-agents", "must be at least 1")
+	}
+	if f.Agent.MinAgents < 0 {
+		resultErr = invalid(resultErr, "agent.min-agents", "must not be negative")
+	}
+	resultErr = validateDurationOrZero(resultErr, "agent.registration-timeout", f.Agent.RegistrationTimeout)
+	resultErr = validateDurationOrZero(resultErr, "agent.gc-interval", f.Agent.GCInterval)
+	resultErr = validateDurationOrZero(resultErr, "agent.max-lifetime", f.Agent.MaxLifetime)
+	resultErr = f.Agent.Scaling.validate(resultErr, "agent")
+	resultErr = validateExecutor(resultErr, "executor", f.Executor)
+	for name, options := range f.Executors {
+		field := fmt.Sprintf("executors.%s", name)
+		resultErr = validateExecutor(resultErr, field, name)
+		resultErr = validateOptions(resultErr, field, name, options)
+	}
+
+	names := sets.Empty()
+	for index, pool := range f.Pools {
+		field := fmt.Sprintf("pools[%d]", index)
+		if pool.Name == "" {
+			resultErr = invalid(resultErr, field+".name", "is required")
+		} else if names.Contains(pool.Name) {
+			resultErr = invalid(resultErr, field+".name", fmt.Sprintf("%s is defined more than once", pool.Name))
+		}
+		names.Add(pool.Name)
+		if pool.MaxAgents < 0 {
+			resultErr = invalid(resultErr, field+".max-agents", "must be at least 1")
+		}
+		if pool.MinAgents < 0 {
+			resultErr = invalid(resultErr, field+".min-agents", "must not be negative")
+		} else if pool.MaxAgents > 0 && pool.MinAgents > pool.MaxAgents {
+			resultErr = invalid(resultErr, field+".min-agents", "must not be more than max-agents")
+		}
+		resultErr = validateDuration(resultErr, field+".poll-interval", pool.PollInterval)
+		resultErr = validateDurationOrZero(resultErr, field+".registration-timeout", pool.RegistrationTimeout)
+		resultErr = validateDurationOrZero(resultErr, field+".gc-interval", pool.GCInterval)
+		resultErr = validateDurationOrZero(resultErr, field+".max-lifetime", pool.MaxLifetime)
+		resultErr = pool.Scaling.validate(resultErr, field)
+		resultErr = validateExecutor(resultErr, field+".executor", pool.Executor)
+		executorName := pool.Executor
+		if executorName == "" {
+			executorName = f.Executor
+		}
+		if executorName != "" {
+			resultErr = validateOptions(resultErr, field+".additional", executorName, pool.Additional)
+		}
+		resultErr = pool.validateProfiles(resultErr, field, executorName)
+	}
+
+	return resultErr.ErrorOrNil()
+}
+
+// Settings - Pool settings in the form understood by pool.FromSettings
+func (p *Pool) Settings() map[string]string {
+	settings := make(map[string]string)
+	for key, value := range p.Additional {
+		settings[key] = value
+	}
+	if p.Env != nil {
+		settings["env"] = strings.Join(p.Env, ",")
+	}
+	if p.Resources != nil {
+		settings["resources"] = strings.Join(p.Resources, ",")
+	}
+	if p.MaxAgents != 0 {
+		settings["max-agents"] = strconv.Itoa(p.MaxAgents)
+	}
+	if p.MinAgents != 0 {
+		settings["min-agents"] = strconv.Itoa(p.MinAgents)
+	}
+	if p.PollInterval != "" {
+		settings["poll-interval"] = p.PollInterval
+	}
+	if p.Executor != "" {
+		settings["executor"] = p.Executor
+	}
+	if p.MaxLifetime != "" {
+		settings["max-lifetime"] = p.MaxLifetime
+	}
+	if p.Ephemeral {
+		settings["ephemeral"] = "true"
+	}
+	if p.DryRun {
+		settings["dry-run"] = "true"
+	}
+	if p.RegistrationTimeout != "" {
+		settings["registration-timeout"] = p.RegistrationTimeout
+	}
+	if p.GCInterval != "" {
+		settings["gc-interval"] = p.GCInterval
+	}
+	if p.Scaling.Policy != "" {
+		settings["scaling-policy"] = p.Scaling.Policy
+	}
+	if p.Scaling.Step != 0 {
+		settings["scaling-step"] = strconv.Itoa(p.Scaling.Step)
+	}
+	if p.Scaling.Factor != 0 {
+		settings["scaling-factor"] = strconv.FormatFloat(p.Scaling.Factor, 'g', -1, 64)
+	}
+	if p.Scaling.ScaleUpCooldown != "" {
+		settings["scale-up-cooldown"] = p.Scaling.ScaleUpCooldown
+	}
+	if p.Scaling.ScaleDownCooldown != "" {
+		settings["scale-down-cooldown"] = p.Scaling.ScaleDownCooldown
+	}
+	if p.Scaling.MinIdleTime != "" {
+		settings["min-idle-time"] = p.Scaling.MinIdleTime
+	}
+	return settings
+}
+
+// Expand - One pool per profile, in the order they're defined. A pool without profiles is returned as is.
+func (p *Pool) Expand() []*Pool {
+	if len(p.Profiles) == 0 {
+		return []*Pool{p}
+	}
+	var pools []*Pool
+	for _, profile := range p.Profiles {
+		pool := *p
+		pool.Name = fmt.Sprintf("%s-%s", p.Name, profile.Name)
+		pool.Profiles = nil
+		if profile.Env != nil {
+			pool.Env = profile.Env
+		}
+		pool.Resources = append(append([]string{}, p.Resources...), profile.Resources...)
+		if profile.MaxAgents != 0 {
+			pool.MaxAgents = profile.MaxAgents
+		}
+		if profile.MinAgents != 0 {
+			pool.MinAgents = profile.MinAgents
+		}
+		pool.Additional = make(map[string]string)
+		for key, value := range p.Additional {
+			pool.Additional[key] = value
+		}
+		for key, value := range profile.Additional {
+			pool.Additional[key] = value
+		}
+		pools = append(pools, &pool)
+	}
+	return pools
+}
+
+// validateProfiles - Profiles are told apart by the env and resources of their agents, so those must differ too
+func (p *Pool) validateProfiles(resultErr *multierror.Error, parent string, executorName string) *multierror.Error {
+	if len(p.Profiles) == 0 {
+		return resultErr
+	}
+	names := sets.Empty()
+	agents := sets.Empty()
+	expanded := p.Expand()
+	for index, profile := range p.Profiles {
+		field := fmt.Sprintf("%s.profiles[%d]", parent, index)
+		if key := agentsOf(expanded[index]); agents.Contains(key) {
+			resultErr = invalid(resultErr, field, "must have a different env or resources than the other profiles")
+		} else {
+			agents.Add(key)
+		}
+		if profile.Name == "" {
+			resultErr = invalid(resultErr, field+".name", "is required")
+		} else if names.Contains(profile.Name) {
+			resultErr = invalid(resultErr, field+".name", fmt.Sprintf("%s is defined more than once", profile.Name))
+		}
+		names.Add(profile.Name)
+		if profile.MaxAgents < 0 {
+			resultErr = invalid(resultErr, field+".max-agents", "must be at least 1")
+		} else if p.MaxAgents > 0 && profile.MaxAgents > p.MaxAgents {
+			resultErr = invalid(resultErr, field+".max-agents", "must not be more than the max-agents of the pool")
+		}
+		if profile.MinAgents < 0 {
+			resultErr = invalid(resultErr, field+".min-agents", "must not be negative")
+		}
+		if executorName != "" {
+			resultErr = validateOptions(resultErr, field+".additional", executorName, profile.Additional)
+		}
+	}
+	return resultErr
+}
+
+// agentsOf - Env and resources of the agents of the pool, irrespective of their order
+func agentsOf(p *Pool) string {
+	env := sets.FromSlice(p.Env).Values()
+	resources := sets.FromSlice(p.Resources).Values()
+	sort.Strings(env)
+	sort.Strings(resources)
+	return fmt.Sprintf("env=%s;resources=%s", strings.Join(env, ","), strings.Join(resources, ","))
+}
+
+// validate the values that were given, the rest fall back to the flags
+func (s Scaling) validate(resultErr *multierror.Error, parent string) *multierror.Error {
+	if _, err := scalar.NewScalingPolicy(s.Policy, 1, 1); err != nil {
+		resultErr = invalid(resultErr, parent+".scaling-policy", err.Error())
+	}
+	if s.Step < 0 {
+		resultErr = invalid(resultErr, parent+".scaling-step", "must be at least 1")
+	}
+	if s.Factor < 0 || s.Factor > 1 {
+		resultErr = invalid(resultErr, parent+".scaling-factor", "must be within (0, 1]")
+	}
+	resultErr = validateDurationOrZero(resultErr, parent+".scale-up-cooldown", s.ScaleUpCooldown)
+	resultErr = validateDurationOrZero(resultErr, parent+".scale-down-cooldown", s.ScaleDownCooldown)
+	resultErr = validateDurationOrZero(resultErr, parent+".min-idle-time", s.MinIdleTime)
+	return resultErr
+}
+
+// validateDuration - A duration that must be positive, if it's set
+func validateDuration(resultErr *multierror.Error, field string, value string) *multierror.Error {
+	if value == "" {
+		return resultErr
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return invalid(resultErr, field, err.Error())
+	}
+	if duration <= 0 {
+		return invalid(resultErr, field, "must be positive")
+	}
+	return resultErr
+}
+
+// validateDurationOrZero - A duration that turns the feature off when it's 0, if it's set
+func validateDurationOrZero(resultErr *multierror.Error, field string, value string) *multierror.Error {
+	if value == "" {
+		return resultErr
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return invalid(resultErr, field, err.Error())
+	}
+	if duration < 0 {
+		return invalid(resultErr, field, "must not be negative")
+	}
+	return resultErr
+}
+
+func validateExecutor(resultErr *multierror.Error, field string, name string) *multierror.Error {
+	if name == "" {
+		return resultErr
+	}
+	if _, err := executor.New(name); err != nil {
+		return invalid(resultErr, field, err.Error())
+	}
+	return resultErr
+}
+
+func validateOptions(resultErr *multierror.Error, field string, executorName string, options map[string]string) *multierror.Error {
+	known := sets.Empty()
+	for _, option := range executor.Options(executorName) {
+		known.Add(option.Name)
+	}
+	for name := range options {
+		if !known.Contains(name) {
+			resultErr = invalid(resultErr, fmt.Sprintf("%s.%s", field, name), fmt.Sprintf("unknown option for executor %s", executorName))
+		}
+	}
+	return resultErr
+}
+
+func invalid(resultErr *multierror.Error, field string, reason string) *multierror.Error {
+	return multierror.Append(resultErr, fmt.Errorf("%s %s", field, reason))
+}
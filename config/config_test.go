@@ -0,0 +1,213 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/ind9/vasuki/executor"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	executor.Register("test", func() executor.Executor { return new(executor.MockExecutor) },
+		executor.Option{Name: "image", Default: "default-image"})
+}
+
+func writeConfig(t *testing.T, name string, content string) string {
+	dir, err := ioutil.TempDir("", "vasuki-config")
+	assert.NoError(t, err)
+	path := filepath.Join(dir, name)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoadYAML(t *testing.T) {
+	path := writeConfig(t, "vasuki.yml", `
+server:
+  host: gocd.example.com
+  port: 8154
+  poll-interval: 1m
+agent:
+  auto-register-key: secret
+executor: test
+executors:
+  test:
+    image: base-image
+pools:
+  - name: ft
+    env: [FT]
+    resources: [FT, chrome]
+    max-agents: 5
+    scaling-policy: fixed-step
+    scaling-step: 2
+    min-idle-time: 10m
+    registration-timeout: 5m
+    gc-interval: 1h
+    additional:
+      image: selenium
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	file, err := Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "gocd.example.com", file.Server.Host)
+	assert.Equal(t, 8154, file.Server.Port)
+	assert.Equal(t, "secret", file.Agent.AutoRegisterKey)
+	assert.Equal(t, "base-image", file.Executors["test"]["image"])
+	assert.Len(t, file.Pools, 1)
+	assert.Equal(t, map[string]string{
+		"env":                  "FT",
+		"resources":            "FT,chrome",
+		"max-agents":           "5",
+		"scaling-policy":       "fixed-step",
+		"scaling-step":         "2",
+		"min-idle-time":        "10m",
+		"registration-timeout": "5m",
+		"gc-interval":          "1h",
+		"image":                "selenium",
+	}, file.Pools[0].Settings())
+}
+
+func TestLoadJSON(t *testing.T) {
+	path := writeConfig(t, "vasuki.json", `{
+	"server": {"host": "gocd.example.com"},
+	"executor": "test",
+	"pools": [{"name": "uat", "env": ["UAT"], "poll-interval": "10s", "scaling-policy": "proportional", "scaling-factor": 0.5}]
+}`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	file, err := Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "gocd.example.com", file.Server.Host)
+	assert.Equal(t, "uat", file.Pools[0].Name)
+	assert.Equal(t, "10s", file.Pools[0].PollInterval)
+	assert.Equal(t, "proportional", file.Pools[0].Scaling.Policy)
+	assert.Equal(t, 0.5, file.Pools[0].Scaling.Factor)
+}
+
+func TestLoadFailsForUnknownFields(t *testing.T) {
+	path := writeConfig(t, "vasuki.yml", `
+server:
+  hostname: gocd.example.com
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	_, err := Load(path)
+	assert.Error(t, err)
+}
+
+func TestValidateReportsEveryInvalidField(t *testing.T) {
+	file := &File{
+		Server: Server{
+			Port:         70000,
+			PollInterval: "often",
+		},
+		Executor: "unknown",
+		Pools: []*Pool{
+			{Name: "ft", MaxAgents: -1, PollInterval: "-1s", Executor: "test", Additional: map[string]string{"colour": "blue"}},
+			{Name: "ft", Executor: "test", MinAgents: 3, MaxAgents: 2},
+			{Executor: "test", Scaling: Scaling{Policy: "exponential", Factor: 2}},
+		},
+	}
+
+	err := file.Validate()
+	assert.Error(t, err)
+	assert.Len(t, err.(*multierror.Error).Errors, 11)
+	for _, field := range []string{"server.port", "server.poll-interval", "executor", "pools[0].max-agents",
+		"pools[0].poll-interval", "pools[0].additional.colour", "pools[1].name", "pools[1].min-agents", "pools[2].name",
+		"pools[2].scaling-policy", "pools[2].scaling-factor"} {
+		assert.Contains(t, err.Error(), field)
+	}
+}
+
+func TestValidateAcceptsZeroToTurnOffADuration(t *testing.T) {
+	file := &File{
+		Agent: Agent{
+			RegistrationTimeout: "0",
+			GCInterval:          "0",
+			MaxLifetime:         "0s",
+			Scaling:             Scaling{ScaleUpCooldown: "0", ScaleDownCooldown: "0", MinIdleTime: "0"},
+		},
+		Pools: []*Pool{{Name: "ft", GCInterval: "0", MaxLifetime: "0", RegistrationTimeout: "0"}},
+	}
+	assert.NoError(t, file.Validate())
+
+	file = &File{
+		Server: Server{PollInterval: "0"},
+		Drain:  Drain{Timeout: "0"},
+		Agent:  Agent{GCInterval: "-1m"},
+	}
+	err := file.Validate()
+	assert.Error(t, err)
+	assert.Len(t, err.(*multierror.Error).Errors, 3)
+	assert.Contains(t, err.Error(), "agent.gc-interval must not be negative")
+}
+
+func TestExpandMakesAPoolOfEveryProfile(t *testing.T) {
+	pool := &Pool{
+		Name:       "ft",
+		Env:        []string{"FT"},
+		Resources:  []string{"FT"},
+		MaxAgents:  5,
+		Additional: map[string]string{"image": "gocd-agent", "memory": "2g"},
+		Profiles: []*Profile{
+			{Name: "selenium", Resources: []string{"chrome"}, MaxAgents: 2, Additional: map[string]string{"image": "selenium"}},
+			{Name: "jdk11", Env: []string{"UAT"}, Resources: []string{"jdk11"}},
+		},
+	}
+
+	pools := pool.Expand()
+	assert.Len(t, pools, 2)
+	assert.Equal(t, map[string]string{
+		"env":        "FT",
+		"resources":  "FT,chrome",
+		"max-agents": "2",
+		"image":      "selenium",
+		"memory":     "2g",
+	}, pools[0].Settings())
+	assert.Equal(t, "ft-selenium", pools[0].Name)
+	assert.Equal(t, map[string]string{
+		"env":        "UAT",
+		"resources":  "FT,jdk11",
+		"max-agents": "5",
+		"image":      "gocd-agent",
+		"memory":     "2g",
+	}, pools[1].Settings())
+	assert.Equal(t, "ft-jdk11", pools[1].Name)
+	assert.Equal(t, []string{"FT"}, pool.Resources)
+	assert.Equal(t, "gocd-agent", pool.Additional["image"])
+}
+
+func TestExpandWithoutProfiles(t *testing.T) {
+	pool := &Pool{Name: "ft"}
+
+	assert.Equal(t, []*Pool{pool}, pool.Expand())
+}
+
+func TestValidateProfiles(t *testing.T) {
+	file := &File{
+		Executor: "test",
+		Pools: []*Pool{{
+			Name:      "ft",
+			MaxAgents: 2,
+			Profiles: []*Profile{
+				{Name: "selenium", MaxAgents: -1},
+				{Name: "jdk11", Resources: []string{"jdk11"}, MaxAgents: 3},
+				{Name: "selenium", Additional: map[string]string{"colour": "blue"}},
+				{Resources: []string{"chrome"}, MinAgents: -1},
+			},
+		}},
+	}
+
+	err := file.Validate()
+	assert.Error(t, err)
+	assert.Len(t, err.(*multierror.Error).Errors, 7)
+	for _, field := range []string{"pools[0].profiles[0].max-agents", "pools[0].profiles[1].max-agents must not be more",
+		"pools[0].profiles[2].name", "pools[0].profiles[2] must have a different env or resources",
+		"pools[0].profiles[2].additional.colour", "pools[0].profiles[3].name", "pools[0].profiles[3].min-agents"} {
+		assert.Contains(t, err.Error(), field)
+	}
+}
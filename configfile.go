@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ind9/vasuki/config"
+	"github.com/ind9/vasuki/utils/sets"
+	"github.com/spf13/pflag"
+)
+
+// Pools read from the config file
+var filePools []*config.Pool
+
+// Flags that were explicitly given on the command line, they win over the config file
+var explicitFlags = sets.Empty()
+
+// applyConfigFile - Uses the values of the config file for every flag that wasn't given on the command line
+func applyConfigFile(flags *pflag.FlagSet, file *config.File) error {
+	flags.Visit(func(flag *pflag.Flag) {
+		explicitFlags.Add(flag.Name)
+	})
+
+	values := map[string]string{
+		"server-host":                file.Server.Host,
+		"server-username":            file.Server.Username,
+		"server-password":            file.Server.Password,
+		"server-poll-interval":       file.Server.PollInterval,
+		"server-max-backoff":         file.Server.MaxBackoff,
+		"agent-auto-register-key":    file.Agent.AutoRegisterKey,
+		"executor":                   file.Executor,
+		"http-addr":                  file.HTTPAddr,
+		"drain-timeout":              file.Drain.Timeout,
+		"agent-scaling-policy":       file.Agent.Scaling.Policy,
+		"agent-scale-up-cooldown":    file.Agent.Scaling.ScaleUpCooldown,
+		"agent-scale-down-cooldown":  file.Agent.Scaling.ScaleDownCooldown,
+		"agent-min-idle-time":        file.Agent.Scaling.MinIdleTime,
+		"agent-registration-timeout": file.Agent.RegistrationTimeout,
+		"agent-gc-interval":          file.Agent.GCInterval,
+		"agent-max-lifetime":         file.Agent.MaxLifetime,
+	}
+	if file.Server.Port != 0 {
+		values["server-port"] = strconv.Itoa(file.Server.Port)
+	}
+	if file.Agent.Env != nil {
+		values["agent-env"] = strings.Join(file.Agent.Env, ",")
+	}
+	if file.Agent.Resources != nil {
+		values["agent-resources"] = strings.Join(file.Agent.Resources, ",")
+	}
+	if file.Agent.MaxAgents != 0 {
+		values["agent-max-count"] = strconv.Itoa(file.Agent.MaxAgents)
+	}
+	if file.Agent.MinAgents != 0 {
+		values["agent-min-count"] = strconv.Itoa(file.Agent.MinAgents)
+	}
+	if file.Agent.Scaling.Step != 0 {
+		values["agent-scaling-step"] = strconv.Itoa(file.Agent.Scaling.Step)
+	}
+	if file.Agent.Scaling.Factor != 0 {
+		values["agent-scaling-factor"] = strconv.FormatFloat(file.Agent.Scaling.Factor, 'g', -1, 64)
+	}
+	if file.Agent.Ephemeral {
+		values["agent-ephemeral"] = "true"
+	}
+	if file.Verbose {
+		values["verbose"] = "true"
+	}
+	if file.DryRun {
+		values["dry-run"] = "true"
+	}
+	if file.Drain.OnExit {
+		values["drain-on-exit"] = "true"
+	}
+	for executorName, options := range file.Executors {
+		for option, value := range options {
+			values[fmt.Sprintf("%s-%s", executorName, option)] = value
+		}
+	}
+
+	for name, value := range values {
+		if value == "" || explicitFlags.Contains(name) {
+			continue
+		}
+		if err := flags.Set(name, value); err != nil {
+			return fmt.Errorf("Invalid value %q for %s in config file: %s", value, name, err)
+		}
+	}
+
+	filePools = file.Pools
+	return nil
+}
+
+// withFlagOverrides - Replaces the settings of a pool from the config file with the flags given on the command line
+func withFlagOverrides(settings map[string]string) map[string]string {
+	if explicitFlags.Contains("executor") {
+		settings["executor"] = executorName
+	}
+	if explicitFlags.Contains("agent-env") {
+		settings["env"] = strings.Join(env, ",")
+	}
+	if explicitFlags.Contains("agent-resources") {
+		settings["resources"] = strings.Join(resources, ",")
+	}
+	if explicitFlags.Contains("agent-max-count") {
+		settings["max-agents"] = strconv.Itoa(maxAgents)
+	}
+	if explicitFlags.Contains("agent-min-count") {
+		settings["min-agents"] = strconv.Itoa(minAgents)
+	}
+	if explicitFlags.Contains("agent-scaling-policy") {
+		settings["scaling-policy"] = scalingPolicy
+	}
+	if explicitFlags.Contains("agent-scaling-step") {
+		settings["scaling-step"] = strconv.Itoa(scalingStep)
+	}
+	if explicitFlags.Contains("agent-scaling-factor") {
+		settings["scaling-factor"] = strconv.FormatFloat(scalingFactor, 'g', -1, 64)
+	}
+	if explicitFlags.Contains("agent-scale-up-cooldown") {
+		settings["scale-up-cooldown"] = scaleUpCooldown.String()
+	}
+	if explicitFlags.Contains("agent-scale-down-cooldown") {
+		settings["scale-down-cooldown"] = scaleDownCooldown.String()
+	}
+	if explicitFlags.Contains("agent-min-idle-time") {
+		settings["min-idle-time"] = minIdleTime.String()
+	}
+	if explicitFlags.Contains("agent-registration-timeout") {
+		settings["registration-timeout"] = registrationTimeout.String()
+	}
+	if explicitFlags.Contains("agent-gc-interval") {
+		settings["gc-interval"] = gcInterval.String()
+	}
+	if explicitFlags.Contains("agent-max-lifetime") {
+		settings["max-lifetime"] = maxLifetime.String()
+	}
+	if explicitFlags.Contains("agent-ephemeral") {
+		settings["ephemeral"] = strconv.FormatBool(ephemeral)
+	}
+	if explicitFlags.Contains("server-poll-interval") {
+		settings["poll-interval"] = pollInterval.String()
+	}
+
+	poolExecutor, present := settings["executor"]
+	if !present {
+		poolExecutor = executorName
+	}
+	for option, value := range executorAdditionalConfig(poolExecutor) {
+		if explicitFlags.Contains(fmt.Sprintf("%s-%s", poolExecutor, option)) {
+			settings[option] = value
+		}
+	}
+	return settings
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ind9/vasuki/config"
+	"github.com/ind9/vasuki/scalar"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlagsOverrideTheConfigFile(t *testing.T) {
+	flags := vasukiCommand.PersistentFlags()
+	assert.NoError(t, flags.Parse([]string{"--server-host", "gocd.local", "--agent-max-count", "7"}))
+
+	file := &config.File{
+		Server: config.Server{Host: "gocd.example.com", Port: 8154},
+		Pools: []*config.Pool{
+			{Name: "ft", Env: []string{"FT"}, MaxAgents: 3, Additional: map[string]string{"image": "selenium"}},
+		},
+	}
+	assert.NoError(t, applyConfigFile(flags, file))
+
+	assert.Equal(t, "gocd.local", goServerHost)
+	assert.Equal(t, 8154, goServerPort)
+
+	configs, err := poolConfigs()
+	assert.NoError(t, err)
+	assert.Len(t, configs, 1)
+	assert.Equal(t, "ft", configs[0].Name)
+	assert.Equal(t, []string{"FT"}, configs[0].Scalar.Env)
+	assert.Equal(t, 7, configs[0].Scalar.MaxAgents)
+	assert.Equal(t, "selenium", configs[0].ExecutorConfig.Additional["image"])
+	assert.Equal(t, 8154, configs[0].ExecutorConfig.ServerPort)
+}
+
+func TestDryRunAppliesToEveryPool(t *testing.T) {
+	dryRun = true
+	defer func() { dryRun = false }()
+	filePools = []*config.Pool{{Name: "ft"}}
+	defer func() { filePools = nil }()
+
+	configs, err := poolConfigs()
+	assert.NoError(t, err)
+	assert.Len(t, configs, 1)
+	assert.True(t, configs[0].Scalar.DryRun)
+}
+
+func TestEveryProfileIsAPool(t *testing.T) {
+	filePools = []*config.Pool{{
+		Name:      "ft",
+		Resources: []string{"FT"},
+		Profiles: []*config.Profile{
+			{Name: "selenium", Resources: []string{"chrome"}, Additional: map[string]string{"image": "selenium"}},
+			{Name: "jdk11", Resources: []string{"jdk11"}, Additional: map[string]string{"image": "gocd-agent-jdk11"}},
+		},
+	}}
+	defer func() { filePools = nil }()
+
+	configs, err := poolConfigs()
+	assert.NoError(t, err)
+	assert.Len(t, configs, 2)
+	assert.Equal(t, "ft-selenium", configs[0].Name)
+	assert.Equal(t, []string{"FT", "chrome"}, configs[0].Scalar.Resources)
+	assert.Equal(t, "selenium", configs[0].ExecutorConfig.Additional["image"])
+	assert.Empty(t, configs[0].Scalar.Preceding)
+	assert.Equal(t, "ft-jdk11", configs[1].Name)
+	assert.Equal(t, "gocd-agent-jdk11", configs[1].ExecutorConfig.Additional["image"])
+	assert.Equal(t, []*scalar.Config{configs[0].Scalar}, configs[1].Scalar.Preceding)
+	assert.Equal(t, configs[0].Scalar.MaxAgents, configs[0].Scalar.Shared.Max)
+	assert.True(t, configs[0].Scalar.Shared == configs[1].Scalar.Shared)
+}
@@ -1,140 +1,454 @@
 package docker
 
 import (
+	"bytes"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/fsouza/go-dockerclient"
 	"github.com/hashicorp/go-multierror"
 	"github.com/ind9/vasuki/executor"
 	"github.com/ind9/vasuki/utils/logging"
+	"github.com/ind9/vasuki/utils/sets"
 	"github.com/satori/go.uuid"
 )
 
-// Executor - Docker based Executor implementation
+// # of lines of an agent's output that are captured by Logs
+const logLines = "100"
+
+// # of agents that are provisioned at the same time, unless configured otherwise
+const defaultParallelism = 4
+
+// Executor - Docker based Executor implementation. Agents are spread across one or more Docker hosts.
 type Executor struct {
 	config       *executor.Config
-	dockerClient *docker.Client
+	hosts        []*host
+	placement    string // Strategy to pick the host of a new agent
 	dockerImage  string
+	hostConfig   *docker.HostConfig // Resource limits, volumes and networking of the agent containers
+	pullPolicy   string
+	parallelism  int // # of agents that are provisioned at the same time
+	registryAuth docker.AuthConfiguration
+
+	// Guards the fields below, they're updated by the provisioning workers
+	mutex    sync.Mutex
+	nextHost int              // Position of the round-robin placement
+	hostOf   map[string]*host // Host each agent was last seen on, keyed by its UUID
 }
 
 // Init - Initialize this Executor instance
 func (e *Executor) Init(config *executor.Config) (err error) {
 	e.config = config
-	dockerEndpoint := config.Additional["DOCKER_ENDPOINT"]
-	e.dockerImage = config.Additional["DOCKER_IMAGE"]
-	if config.Additional["DOCKER_FROM_ENV"] == "true" {
-		e.dockerClient, err = docker.NewClientFromEnv()
+	e.hostOf = make(map[string]*host)
+	e.dockerImage = config.Additional["image"]
+	if e.dockerImage == "" {
+		return fmt.Errorf("docker: image is required")
+	}
+	if e.hostConfig, err = hostConfigFrom(config.Additional); err != nil {
+		return err
+	}
+	if e.pullPolicy, err = validatePullPolicy(config.Additional["pull-policy"]); err != nil {
+		return err
+	}
+	if e.placement, err = validatePlacement(config.Additional["placement"], e.hostConfig.Memory); err != nil {
+		return err
+	}
+	if e.registryAuth, err = registryAuth(e.dockerImage, config.Additional); err != nil {
 		return err
 	}
-	e.dockerClient, err = docker.NewClient(dockerEndpoint)
-	return err
+	e.parallelism = defaultParallelism
+	if parallelism := config.Additional["parallelism"]; parallelism != "" {
+		if e.parallelism, err = strconv.Atoi(parallelism); err != nil || e.parallelism < 1 {
+			return fmt.Errorf("docker: parallelism must be at least 1, found %q", parallelism)
+		}
+	}
+	if config.Additional["env"] == "true" {
+		// TLS is then set up by DOCKER_TLS_VERIFY and DOCKER_CERT_PATH, the options would be ignored
+		for _, option := range []string{"tls-ca", "tls-cert", "tls-key"} {
+			if config.Additional[option] != "" {
+				return fmt.Errorf("docker: %s can't be used with env=true, set DOCKER_TLS_VERIFY and DOCKER_CERT_PATH instead", option)
+			}
+		}
+		client, err := docker.NewClientFromEnv()
+		if err != nil {
+			return err
+		}
+		e.hosts = []*host{{endpoint: client.Endpoint(), client: client}}
+		return nil
+	}
+
+	// endpoints takes precedence over endpoint, so a pool can be spread across several hosts
+	endpoints := splitList(config.Additional["endpoints"])
+	if len(endpoints) == 0 && config.Additional["endpoint"] != "" {
+		endpoints = []string{config.Additional["endpoint"]}
+	}
+	if len(endpoints) == 0 {
+		return fmt.Errorf("docker: endpoint is required when settings are not picked up from env")
+	}
+	tls, err := tlsFilesFor(config.Additional, endpoints)
+	if err != nil {
+		return err
+	}
+	for index, endpoint := range endpoints {
+		var client *docker.Client
+		if tls[index] != nil {
+			client, err = docker.NewTLSClient(endpoint, tls[index].cert, tls[index].key, tls[index].ca)
+		} else {
+			client, err = docker.NewClient(endpoint)
+		}
+		if err != nil {
+			return fmt.Errorf("docker: invalid endpoint %s - %s", endpoint, err)
+		}
+		e.hosts = append(e.hosts, &host{endpoint: endpoint, client: client})
+	}
+	return nil
 }
 
-// ScaleUp - Initiate a scaleUp activity among the agents that are managed by this executor instance
-func (e *Executor) ScaleUp(instances int) (err error) {
+// ScaleUp - Initiate a scaleUp activity among the agents that are managed by this executor instance.
+// Every agent is placed on one of the reachable hosts by the placement strategy, up to parallelism agents
+// are provisioned at a time.
+func (e *Executor) ScaleUp(instances int) (executor.Result, error) {
 	logging.Log.Infof("Scaling up %d agents via Docker", instances)
-	containerLabels := make(map[string]string, 0)
-	containerLabels["ENV"] = strings.Join(e.config.Env, ",")
-	containerLabels["RESOURCES"] = strings.Join(e.config.Resources, ",")
-	containerLabels["VASUKI_MANAGED"] = "true" // watermark to find the containers we spun
+	var result executor.Result
+	loads := e.loads()
+	if len(loads) == 0 {
+		return result, fmt.Errorf("docker: none of the Docker hosts are reachable")
+	}
+	e.mutex.Lock()
+	var placed []*host
+	placed, e.nextHost = place(e.placement, loads, instances, e.hostConfig.Memory, e.nextHost)
+	e.mutex.Unlock()
+
+	// The image is only made available on the hosts that got agents
+	imageErrs := make(map[*host]error)
 	var resultErr *multierror.Error
-	for count := 0; count < instances; count++ {
-		agentID := uuid.NewV4()
-		containerLabels["GO_AGENT_UUID"] = agentID.String()
-
-		config := &docker.Config{
-			Image: e.dockerImage,
-			Env: []string{
-				fmt.Sprintf("GO_SERVER=%s", e.config.ServerHost),
-				fmt.Sprintf("GO_SERVER_PORT=%d", e.config.ServerPort),
-				fmt.Sprintf("AGENT_ENVIRONMENTS=%s", strings.Join(e.config.Env, ",")),
-				fmt.Sprintf("AGENT_RESOURCES=%s", strings.Join(e.config.Resources, ",")),
-				fmt.Sprintf("AGENT_KEY=%s", e.config.AutoRegisterKey),
-				fmt.Sprintf("AGENT_GUID=%s", agentID.String()),
-			},
-			Labels: containerLabels,
-		}
-		opts := docker.CreateContainerOptions{
-			Config: config,
-		}
-		container, err := e.dockerClient.CreateContainer(opts)
-		resultErr = updateErrors(resultErr, err)
-		if err == nil {
-			err = e.dockerClient.StartContainer(container.ID, nil)
-			resultErr = updateErrors(resultErr, err)
+	for _, h := range placed {
+		if _, checked := imageErrs[h]; !checked {
+			imageErrs[h] = e.ensureImage(h)
+			resultErr = updateErrors(resultErr, imageErrs[h])
 		}
-		logging.Log.Debugf("Started agent container %s", agentID.String())
+	}
+	if resultErr != nil && len(resultErr.Errors) == len(imageErrs) {
+		return result, resultErr.ErrorOrNil()
 	}
 
-	return err
+	// The agents of the hosts without the image are failed before any worker writes to the result
+	var ready []*host
+	for _, h := range placed {
+		if err := imageErrs[h]; err != nil {
+			result.Fail(uuid.NewV4().String(), err)
+		} else {
+			ready = append(ready, h)
+		}
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, e.parallelism)
+	for _, h := range ready {
+		agentID := uuid.NewV4().String()
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(h *host) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			err := e.startAgent(h, agentID)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				logging.Log.Warningf("Couldn't start agent container %s on %s: %s", agentID, h.endpoint, err)
+				result.Fail(agentID, err)
+			} else {
+				result.Succeed(agentID)
+			}
+		}(h)
+	}
+	wg.Wait()
+	return result, nil
+}
+
+// startAgent - Creates and starts the container of an agent on the host. A container that was created but
+// couldn't be started is removed, so it doesn't linger until the garbage collector finds it.
+func (e *Executor) startAgent(h *host, agentID string) error {
+	config := &docker.Config{
+		Image: e.dockerImage,
+		Env: []string{
+			fmt.Sprintf("GO_SERVER=%s", e.config.ServerHost),
+			fmt.Sprintf("GO_SERVER_PORT=%d", e.config.ServerPort),
+			fmt.Sprintf("AGENT_ENVIRONMENTS=%s", strings.Join(e.config.Env, ",")),
+			fmt.Sprintf("AGENT_RESOURCES=%s", strings.Join(e.config.Resources, ",")),
+			fmt.Sprintf("AGENT_KEY=%s", e.config.AutoRegisterKey),
+			fmt.Sprintf("AGENT_GUID=%s", agentID),
+		},
+		Labels: map[string]string{
+			"ENV":            strings.Join(e.config.Env, ","),
+			"RESOURCES":      strings.Join(e.config.Resources, ","),
+			"VASUKI_MANAGED": "true", // watermark to find the containers we spun
+			"GO_AGENT_UUID":  agentID,
+		},
+	}
+	opts := docker.CreateContainerOptions{
+		Config:     config,
+		HostConfig: e.hostConfig,
+	}
+	container, err := h.client.CreateContainer(opts)
+	if err != nil {
+		return err
+	}
+	if err = h.client.StartContainer(container.ID, nil); err != nil {
+		if removeErr := removeContainer(h, container.ID); removeErr != nil {
+			logging.Log.Warningf("Couldn't remove the container of agent %s that failed to start: %s", agentID, removeErr)
+		}
+		return err
+	}
+	e.track(agentID, h)
+	logging.Log.Debugf("Started agent container %s on %s", agentID, h.endpoint)
+	return nil
 }
 
 // ScaleDown - Initiate a scaledown activity among the agents that are managed by this executor instance
-func (e *Executor) ScaleDown(agentsToKill []string) (err error) {
-	var resultErr *multierror.Error
+func (e *Executor) ScaleDown(agentsToKill []string) (executor.Result, error) {
+	var result executor.Result
 	for _, agentID := range agentsToKill {
-		containerID, err := e.findContainerIDFor(agentID)
-		resultErr = updateErrors(resultErr, err)
+		container, err := e.findContainerFor(agentID)
 		if err == nil {
-			opts := docker.KillContainerOptions{
-				ID: *containerID,
-			}
-			err := e.dockerClient.KillContainer(opts)
-			logging.Log.Infof("Terminating agent %s created via Docker", agentID)
-			resultErr = updateErrors(resultErr, err)
+			logging.Log.Infof("Terminating agent %s created via Docker on %s", agentID, container.host.endpoint)
+			err = removeContainer(container.host, container.ID)
+		}
+		if err != nil {
+			result.Fail(agentID, err)
+		} else {
+			e.untrack(agentID)
+			result.Succeed(agentID)
 		}
 	}
-	return resultErr.ErrorOrNil()
+	return result, nil
 }
 
-func (e *Executor) findContainerIDFor(agentID string) (*string, error) {
+// CollectGarbage - Removes the containers we spun that have exited, and the ones whose agent isn't known
+// to the GoCD Server even though they were created before launchedBefore. See executor.GarbageCollector.
+func (e *Executor) CollectGarbage(knownAgents []string, launchedBefore time.Time) ([]string, error) {
+	containers, _, err := e.managedContainers(true)
+	if err != nil {
+		return nil, err
+	}
+	known := sets.FromSlice(knownAgents)
 	var resultErr *multierror.Error
+	var removed []string
+	for _, container := range containers {
+		agentID := container.Labels["GO_AGENT_UUID"]
+		if container.State == "exited" || container.State == "dead" {
+			logging.Log.Infof("Removing the container of agent %s that has %s", agentID, container.State)
+		} else if !known.Contains(agentID) && time.Unix(container.Created, 0).Before(launchedBefore) {
+			logging.Log.Infof("Removing the container of agent %s that isn't known to the Go Server", agentID)
+		} else {
+			continue
+		}
+		err := removeContainer(container.host, container.ID)
+		resultErr = updateErrors(resultErr, err)
+		if err == nil {
+			e.untrack(agentID)
+			removed = append(removed, agentID)
+		}
+	}
+	return removed, resultErr.ErrorOrNil()
+}
+
+// removeContainer - Kills the container if it's still running and removes it along with its volumes,
+// so nothing of the agent is left behind on the host
+func removeContainer(h *host, containerID string) error {
+	opts := docker.RemoveContainerOptions{
+		ID:            containerID,
+		RemoveVolumes: true,
+		Force:         true,
+	}
+	return h.client.RemoveContainer(opts)
+}
+
+// managedContainers - Containers we spun for our environment, resource combination on all the reachable
+// hosts, along with the hosts that couldn't be reached. Only the running ones unless all is set. Fails
+// only when none of the hosts could be reached.
+func (e *Executor) managedContainers(all bool, labels ...string) ([]managedContainer, []*host, error) {
 	containerFilters := make(map[string][]string)
-	containerFilters["label"] = []string{
+	containerFilters["label"] = append([]string{
 		"VASUKI_MANAGED=true", // watermark
 		fmt.Sprintf("ENV=%s", strings.Join(e.config.Env, ",")),
 		fmt.Sprintf("RESOURCES=%s", strings.Join(e.config.Resources, ",")),
-		fmt.Sprintf("GO_AGENT_UUID=%s", agentID),
-	}
+	}, labels...)
 	opts := docker.ListContainersOptions{
+		All:     all,
 		Filters: containerFilters,
 	}
-	containers, err := e.dockerClient.ListContainers(opts)
-	resultErr = updateErrors(resultErr, err)
-	if len(containers) < 1 {
-		err = fmt.Errorf("Container for agent id=%s not found", agentID)
-		resultErr = updateErrors(resultErr, err)
+
+	var managed []managedContainer
+	var unreachable []*host
+	var resultErr *multierror.Error
+	for _, h := range e.hosts {
+		containers, err := h.client.ListContainers(opts)
+		if err != nil {
+			logging.Log.Warningf("Skipping the unreachable Docker host %s: %s", h.endpoint, err)
+			resultErr = updateErrors(resultErr, fmt.Errorf("%s: %s", h.endpoint, err))
+			unreachable = append(unreachable, h)
+			continue
+		}
+		seen := sets.Empty()
+		for _, container := range containers {
+			seen.Add(container.Labels["GO_AGENT_UUID"])
+			e.track(container.Labels["GO_AGENT_UUID"], h)
+			managed = append(managed, managedContainer{APIContainers: container, host: h})
+		}
+		if all && len(labels) == 0 {
+			// Every container of ours on the host was listed, the agents that aren't among them are gone
+			e.forgetMissing(h, seen)
+		}
 	}
+	if len(unreachable) == len(e.hosts) {
+		return nil, unreachable, resultErr.ErrorOrNil()
+	}
+	return managed, unreachable, nil
+}
 
-	if resultErr.ErrorOrNil() != nil {
-		return nil, resultErr.ErrorOrNil()
+// findContainerFor - Container of the agent, running or not. It's looked up on the host the agent was
+// last seen on, and on all the hosts when it isn't there.
+func (e *Executor) findContainerFor(agentID string) (*managedContainer, error) {
+	label := fmt.Sprintf("GO_AGENT_UUID=%s", agentID)
+	e.mutex.Lock()
+	h, tracked := e.hostOf[agentID]
+	e.mutex.Unlock()
+	if tracked {
+		// Stopped containers are included, so an agent that has exited can still be removed
+		containers, err := h.client.ListContainers(docker.ListContainersOptions{
+			All:     true,
+			Filters: map[string][]string{"label": {"VASUKI_MANAGED=true", label}},
+		})
+		if err == nil && len(containers) > 0 {
+			return &managedContainer{APIContainers: containers[0], host: h}, nil
+		}
 	}
 
-	return &(containers[0].ID), nil
+	containers, _, err := e.managedContainers(true, label)
+	if err != nil {
+		return nil, err
+	}
+	if len(containers) < 1 {
+		return nil, fmt.Errorf("Container for agent id=%s not found", agentID)
+	}
+	return &containers[0], nil
 }
 
-// ManagedAgents - List of UUIDs of the agents that are managed through this executor instance
-func (e *Executor) ManagedAgents() ([]string, error) {
-	containerFilters := make(map[string][]string)
-	containerFilters["label"] = []string{
-		"VASUKI_MANAGED=true", // watermark
-		fmt.Sprintf("ENV=%s", strings.Join(e.config.Env, ",")),
-		fmt.Sprintf("RESOURCES=%s", strings.Join(e.config.Resources, ",")),
+// track - Remembers the host the agent is on
+func (e *Executor) track(agentID string, h *host) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.hostOf[agentID] = h
+}
+
+// untrack - Forgets the host of an agent that's gone
+func (e *Executor) untrack(agentID string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	delete(e.hostOf, agentID)
+}
+
+// forgetMissing - Forgets the agents tracked on the host that aren't among the given ones
+func (e *Executor) forgetMissing(h *host, present sets.Set) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for agentID, tracked := range e.hostOf {
+		if tracked == h && !present.Contains(agentID) {
+			delete(e.hostOf, agentID)
+		}
 	}
-	opts := docker.ListContainersOptions{
-		Filters: containerFilters,
+}
+
+// ManagedAgents - List of UUIDs of the agents that are managed through this executor instance. The agents
+// last seen on a host that can't be reached are still counted, so the pool doesn't go over its max agents
+// by replacing agents that are most likely still running.
+func (e *Executor) ManagedAgents() ([]string, error) {
+	containers, unreachable, err := e.managedContainers(false)
+	if err != nil {
+		return nil, err
 	}
-	containers, err := e.dockerClient.ListContainers(opts)
 	var agentIds []string
 	for _, container := range containers {
 		agentIds = append(agentIds, container.Labels["GO_AGENT_UUID"])
 	}
-	return agentIds, err
+	return append(agentIds, e.agentsOn(unreachable)...), nil
+}
+
+// agentsOn - Agents that were last seen on any of the hosts, in a stable order
+func (e *Executor) agentsOn(hosts []*host) []string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	var agentIds []string
+	for agentID, h := range e.hostOf {
+		for _, candidate := range hosts {
+			if h == candidate {
+				agentIds = append(agentIds, agentID)
+			}
+		}
+	}
+	sort.Strings(agentIds)
+	return agentIds
+}
+
+// LaunchTimes - When each of the agents managed through this executor instance was created
+func (e *Executor) LaunchTimes() (map[string]time.Time, error) {
+	containers, _, err := e.managedContainers(false)
+	launchTimes := make(map[string]time.Time, len(containers))
+	for _, container := range containers {
+		launchTimes[container.Labels["GO_AGENT_UUID"]] = time.Unix(container.Created, 0)
+	}
+	return launchTimes, err
+}
+
+// Logs - Last lines of the output of the agent's container
+func (e *Executor) Logs(agentID string) (string, error) {
+	container, err := e.findContainerFor(agentID)
+	if err != nil {
+		return "", err
+	}
+	var output bytes.Buffer
+	opts := docker.LogsOptions{
+		Container:    container.ID,
+		OutputStream: &output,
+		ErrorStream:  &output,
+		Stdout:       true,
+		Stderr:       true,
+		Tail:         logLines,
+	}
+	err = container.host.client.Logs(opts)
+	return output.String(), err
 }
 
 func init() {
-	executor.DefaultExecutor = &Executor{}
+	executor.Register("docker", func() executor.Executor { return &Executor{} },
+		executor.Option{Name: "image", Default: "ashwanthkumar/gocd-agent", Usage: "Docker image used for spinning up the agent"},
+		executor.Option{Name: "endpoint", Default: "unix:///var/run/docker.sock", Usage: "Docker endpoint to connect to"},
+		executor.Option{Name: "endpoints", Usage: "Comma separated Docker endpoints to spread the agents across, takes precedence over --docker-endpoint"},
+		executor.Option{Name: "tls-ca", Usage: "CA certificate (PEM) that verifies the Docker daemon. One path for every endpoint, or a comma separated path per endpoint with empty ones for endpoints without TLS"},
+		executor.Option{Name: "tls-cert", Usage: "Client certificate (PEM) for the Docker endpoints, given the same way as --docker-tls-ca"},
+		executor.Option{Name: "tls-key", Usage: "Key (PEM) of the client certificate for the Docker endpoints, given the same way as --docker-tls-ca"},
+		executor.Option{Name: "placement", Default: placeLeastContainers, Usage: "How the Docker host of a new agent is picked. One of least-containers, most-free-memory (requires memory), round-robin"},
+		executor.Option{Name: "env", Default: "false", Boolean: true, Usage: "Flag to pick up docker settings from Env. Useful when working with boot2docker / docker-machine"},
+		executor.Option{Name: "pull-policy", Default: pullIfNotPresent, Usage: "When to pull the image before starting agents. One of always, if-not-present, never"},
+		executor.Option{Name: "registry-config", Usage: "Path to a docker config.json with the credentials of the image's registry"},
+		executor.Option{Name: "registry-username", Usage: "Username for the image's registry, takes precedence over --docker-registry-config"},
+		executor.Option{Name: "registry-password", Secret: true, Usage: "Password for the image's registry"},
+		executor.Option{Name: "parallelism", Default: strconv.Itoa(defaultParallelism), Usage: "Number of agent containers that are created and started at the same time while scaling up"},
+		executor.Option{Name: "cpus", Usage: "Number of CPUs an agent container can use, e.g. 1.5"},
+		executor.Option{Name: "memory", Usage: "Memory limit of an agent container, e.g. 512m or 2g"},
+		executor.Option{Name: "volumes", Usage: "Comma separated host-path:container-path[:ro] bind mounts of an agent container, e.g. caches like ~/.m2"},
+		executor.Option{Name: "network", Usage: "Docker network the agent containers are connected to"},
+		executor.Option{Name: "dns", Usage: "Comma separated DNS servers of an agent container"},
+		executor.Option{Name: "extra-hosts", Usage: "Comma separated host:ip entries added to /etc/hosts of an agent container"},
+		executor.Option{Name: "privileged", Default: "false", Boolean: true, Usage: "Run the agent containers in privileged mode"},
+		executor.Option{Name: "docker-socket", Default: "false", Boolean: true, Usage: "Mount the Docker socket of the host into the agent containers, for docker-in-docker builds"},
+	)
 }
 
 func updateErrors(resultErr *multierror.Error, err error) *multierror.Error {
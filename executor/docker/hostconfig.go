@@ -0,0 +1,91 @@
+package docker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/hashicorp/go-multierror"
+)
+
+// Bind mount that gives the agent access to the Docker daemon of the host, for docker-in-docker builds
+const dockerSocketBind = "/var/run/docker.sock:/var/run/docker.sock"
+
+// Suffixes of the memory option, same as the ones of `docker run --memory`
+var memoryUnits = map[string]int64{
+	"b": 1,
+	"k": 1 << 10,
+	"m": 1 << 20,
+	"g": 1 << 30,
+}
+
+// hostConfigFrom - HostConfig of the agent containers from the options of the executor. Lists are
+// comma separated, every invalid option is reported.
+func hostConfigFrom(options map[string]string) (*docker.HostConfig, error) {
+	var resultErr *multierror.Error
+	hostConfig := &docker.HostConfig{
+		NetworkMode: options["network"],
+		DNS:         splitList(options["dns"]),
+		ExtraHosts:  splitList(options["extra-hosts"]),
+		Privileged:  options["privileged"] == "true",
+	}
+
+	if cpus := options["cpus"]; cpus != "" {
+		value, err := strconv.ParseFloat(cpus, 64)
+		if err != nil || value <= 0 {
+			resultErr = updateErrors(resultErr, fmt.Errorf("docker: cpus must be a positive number, found %q", cpus))
+		}
+		hostConfig.NanoCPUs = int64(value * 1e9)
+	}
+	if memory := options["memory"]; memory != "" {
+		value, err := parseMemory(memory)
+		resultErr = updateErrors(resultErr, err)
+		hostConfig.Memory = value
+	}
+	for _, volume := range splitList(options["volumes"]) {
+		parts := strings.Split(volume, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			resultErr = updateErrors(resultErr, fmt.Errorf("docker: volumes must be of the form host-path:container-path[:ro], found %q", volume))
+		}
+		hostConfig.Binds = append(hostConfig.Binds, volume)
+	}
+	if options["docker-socket"] == "true" {
+		hostConfig.Binds = append(hostConfig.Binds, dockerSocketBind)
+	}
+	for _, host := range hostConfig.ExtraHosts {
+		if parts := strings.SplitN(host, ":", 2); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			resultErr = updateErrors(resultErr, fmt.Errorf("docker: extra-hosts must be of the form host:ip, found %q", host))
+		}
+	}
+
+	if resultErr.ErrorOrNil() != nil {
+		return nil, resultErr.ErrorOrNil()
+	}
+	return hostConfig, nil
+}
+
+// parseMemory - Bytes in a memory limit like 512m or 2g
+func parseMemory(memory string) (int64, error) {
+	value := strings.ToLower(memory)
+	unit := int64(1)
+	if multiplier, present := memoryUnits[value[len(value)-1:]]; present {
+		unit = multiplier
+		value = value[:len(value)-1]
+	}
+	bytes, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || bytes <= 0 {
+		return 0, fmt.Errorf("docker: memory must be a positive number of bytes with an optional b, k, m or g suffix, found %q", memory)
+	}
+	return bytes * unit, nil
+}
+
+func splitList(value string) []string {
+	var elems []string
+	for _, elem := range strings.Split(value, ",") {
+		if elem = strings.TrimSpace(elem); elem != "" {
+			elems = append(elems, elem)
+		}
+	}
+	return elems
+}
@@ -0,0 +1,62 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostConfigFromOptions(t *testing.T) {
+	hostConfig, err := hostConfigFrom(map[string]string{
+		"cpus":          "1.5",
+		"memory":        "2g",
+		"volumes":       "/cache/m2:/root/.m2, /cache/gradle:/root/.gradle:ro",
+		"network":       "gocd",
+		"dns":           "10.0.0.2,10.0.0.3",
+		"extra-hosts":   "gocd.example.com:10.0.0.10",
+		"privileged":    "true",
+		"docker-socket": "true",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1500000000), hostConfig.NanoCPUs)
+	assert.Equal(t, int64(2*1024*1024*1024), hostConfig.Memory)
+	assert.Equal(t, []string{"/cache/m2:/root/.m2", "/cache/gradle:/root/.gradle:ro", dockerSocketBind}, hostConfig.Binds)
+	assert.Equal(t, "gocd", hostConfig.NetworkMode)
+	assert.Equal(t, []string{"10.0.0.2", "10.0.0.3"}, hostConfig.DNS)
+	assert.Equal(t, []string{"gocd.example.com:10.0.0.10"}, hostConfig.ExtraHosts)
+	assert.True(t, hostConfig.Privileged)
+}
+
+func TestHostConfigDefaultsToNoLimits(t *testing.T) {
+	hostConfig, err := hostConfigFrom(map[string]string{"privileged": "false"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), hostConfig.NanoCPUs)
+	assert.Equal(t, int64(0), hostConfig.Memory)
+	assert.Empty(t, hostConfig.Binds)
+	assert.False(t, hostConfig.Privileged)
+}
+
+func TestHostConfigReportsEveryInvalidOption(t *testing.T) {
+	_, err := hostConfigFrom(map[string]string{
+		"cpus":        "many",
+		"memory":      "2 gigs",
+		"volumes":     "/cache/m2",
+		"extra-hosts": "gocd.example.com",
+	})
+	assert.Error(t, err)
+	for _, option := range []string{"cpus", "memory", "volumes", "extra-hosts"} {
+		assert.Contains(t, err.Error(), option)
+	}
+}
+
+func TestParseMemory(t *testing.T) {
+	for memory, expected := range map[string]int64{"1024": 1024, "512k": 512 * 1024, "512M": 512 * 1024 * 1024, "1b": 1} {
+		bytes, err := parseMemory(memory)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, bytes)
+	}
+	for _, memory := range []string{"g", "-1g", "1t"} {
+		_, err := parseMemory(memory)
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,101 @@
+package docker
+
+import (
+	"fmt"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/ind9/vasuki/utils/logging"
+)
+
+// Strategies to pick the Docker host of a new agent
+const (
+	placeLeastContainers = "least-containers"
+	placeMostFreeMemory  = "most-free-memory"
+	placeRoundRobin      = "round-robin"
+)
+
+// host - Docker daemon the agents can be placed on
+type host struct {
+	endpoint string
+	client   *docker.Client
+}
+
+// hostLoad - How busy a reachable host is, as of the start of a scale up
+type hostLoad struct {
+	host       *host
+	containers int // Running containers, including the ones of other pools
+	// Memory that isn't taken by the running containers, going by the memory limit of the agents
+	freeMemory int64
+}
+
+// managedContainer - Container we spun, along with the host it runs on
+type managedContainer struct {
+	docker.APIContainers
+	host *host
+}
+
+// validatePlacement - Defaults to placing agents on the host with the least containers. The free memory of a
+// host is only taken by the agents through their memory limit, so most-free-memory needs one.
+func validatePlacement(strategy string, memory int64) (string, error) {
+	switch strategy {
+	case "":
+		return placeLeastContainers, nil
+	case placeMostFreeMemory:
+		if memory == 0 {
+			return "", fmt.Errorf("docker: placement most-free-memory requires the memory limit of the agents")
+		}
+		return strategy, nil
+	case placeLeastContainers, placeRoundRobin:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("docker: unknown placement %q, available placements are least-containers, most-free-memory, round-robin", strategy)
+}
+
+// loads - Load of every reachable host, the unreachable ones are skipped
+func (e *Executor) loads() []*hostLoad {
+	var loads []*hostLoad
+	for _, h := range e.hosts {
+		info, err := h.client.Info()
+		if err != nil {
+			logging.Log.Warningf("Skipping the unreachable Docker host %s: %s", h.endpoint, err)
+			continue
+		}
+		loads = append(loads, &hostLoad{
+			host:       h,
+			containers: info.ContainersRunning,
+			freeMemory: info.MemTotal - int64(info.ContainersRunning)*e.hostConfig.Memory,
+		})
+	}
+	return loads
+}
+
+// place - Picks a host for each of the agents by the strategy, accounting for the agents that were
+// placed before it. next is the position of the round-robin, the updated one is returned.
+func place(strategy string, loads []*hostLoad, instances int, memory int64, next int) ([]*host, int) {
+	var placed []*host
+	for count := 0; count < instances; count++ {
+		chosen := loads[0]
+		switch strategy {
+		case placeRoundRobin:
+			chosen = loads[next%len(loads)]
+			next++
+		case placeMostFreeMemory:
+			for _, load := range loads[1:] {
+				if load.freeMemory > chosen.freeMemory ||
+					(load.freeMemory == chosen.freeMemory && load.containers < chosen.containers) {
+					chosen = load
+				}
+			}
+		default:
+			for _, load := range loads[1:] {
+				if load.containers < chosen.containers {
+					chosen = load
+				}
+			}
+		}
+		chosen.containers++
+		chosen.freeMemory -= memory
+		placed = append(placed, chosen.host)
+	}
+	return placed, next
+}
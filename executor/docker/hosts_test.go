@@ -0,0 +1,135 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	dockertesting "github.com/fsouza/go-dockerclient/testing"
+	"github.com/ind9/vasuki/executor"
+	"github.com/stretchr/testify/assert"
+)
+
+func testLoads() []*hostLoad {
+	return []*hostLoad{
+		{host: &host{endpoint: "tcp://build-1:2375"}, containers: 4, freeMemory: 8 << 30},
+		{host: &host{endpoint: "tcp://build-2:2375"}, containers: 2, freeMemory: 4 << 30},
+		{host: &host{endpoint: "tcp://build-3:2375"}, containers: 3, freeMemory: 16 << 30},
+	}
+}
+
+func endpointsOf(hosts []*host) []string {
+	var endpoints []string
+	for _, h := range hosts {
+		endpoints = append(endpoints, h.endpoint)
+	}
+	return endpoints
+}
+
+func TestPlaceOnTheHostWithLeastContainers(t *testing.T) {
+	placed, _ := place(placeLeastContainers, testLoads(), 3, 0, 0)
+	assert.Equal(t, []string{"tcp://build-2:2375", "tcp://build-2:2375", "tcp://build-3:2375"}, endpointsOf(placed))
+}
+
+func TestPlaceOnTheHostWithMostFreeMemory(t *testing.T) {
+	placed, _ := place(placeMostFreeMemory, testLoads(), 3, 6<<30, 0)
+	assert.Equal(t, []string{"tcp://build-3:2375", "tcp://build-3:2375", "tcp://build-1:2375"}, endpointsOf(placed))
+}
+
+func TestPlaceRoundRobinCarriesOverAcrossScaleUps(t *testing.T) {
+	loads := testLoads()
+	placed, next := place(placeRoundRobin, loads, 2, 0, 0)
+	assert.Equal(t, []string{"tcp://build-1:2375", "tcp://build-2:2375"}, endpointsOf(placed))
+
+	placed, next = place(placeRoundRobin, loads, 2, 0, next)
+	assert.Equal(t, []string{"tcp://build-3:2375", "tcp://build-1:2375"}, endpointsOf(placed))
+	assert.Equal(t, 4, next)
+}
+
+func TestValidatePlacement(t *testing.T) {
+	placement, err := validatePlacement("", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, placeLeastContainers, placement)
+
+	placement, err = validatePlacement(placeMostFreeMemory, 1<<30)
+	assert.NoError(t, err)
+	assert.Equal(t, placeMostFreeMemory, placement)
+
+	// Without a memory limit the agents don't take any memory, so they'd all land on the biggest host
+	_, err = validatePlacement(placeMostFreeMemory, 0)
+	assert.Error(t, err)
+
+	_, err = validatePlacement("random", 0)
+	assert.Error(t, err)
+}
+
+func TestInitConnectsToEveryEndpoint(t *testing.T) {
+	e := &Executor{}
+	err := e.Init(&executor.Config{Additional: map[string]string{
+		"image":     "gocd-agent",
+		"endpoint":  "unix:///var/run/docker.sock",
+		"endpoints": "tcp://build-1:2375, tcp://build-2:2375",
+		"placement": placeRoundRobin,
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tcp://build-1:2375", "tcp://build-2:2375"}, endpointsOf(e.hosts))
+	assert.Equal(t, placeRoundRobin, e.placement)
+
+	e = &Executor{}
+	err = e.Init(&executor.Config{Additional: map[string]string{"image": "gocd-agent", "endpoint": "unix:///var/run/docker.sock"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"unix:///var/run/docker.sock"}, endpointsOf(e.hosts))
+}
+
+func TestManagedAgentsCountsTheAgentsLastSeenOnUnreachableHosts(t *testing.T) {
+	server, err := dockertesting.NewServer("127.0.0.1:0", nil, nil)
+	assert.NoError(t, err)
+	defer server.Stop()
+	reachable, _ := docker.NewClient(server.URL())
+	unreachable, _ := docker.NewClient("tcp://127.0.0.1:1")
+	assert.NoError(t, reachable.PullImage(docker.PullImageOptions{Repository: "gocd-agent"}, docker.AuthConfiguration{}))
+	e := &Executor{
+		config:      &executor.Config{Env: []string{"FT"}, Resources: []string{"FT"}},
+		dockerImage: "gocd-agent",
+		hostConfig:  &docker.HostConfig{},
+		hosts:       []*host{{endpoint: server.URL(), client: reachable}, {endpoint: "tcp://127.0.0.1:1", client: unreachable}},
+		hostOf:      make(map[string]*host),
+	}
+	assert.NoError(t, e.startAgent(e.hosts[0], "agent-1"))
+	e.track("agent-2", e.hosts[1])
+
+	agents, err := e.ManagedAgents()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"agent-1", "agent-2"}, agents)
+
+	e.hosts = e.hosts[1:]
+	_, err = e.ManagedAgents()
+	assert.Error(t, err)
+}
+
+func TestScaleUpFailsTheAgentsOfHostsWithoutTheImage(t *testing.T) {
+	withImage, err := dockertesting.NewServer("127.0.0.1:0", nil, nil)
+	assert.NoError(t, err)
+	defer withImage.Stop()
+	withImage.PrepareFailure("create-failed", "/containers/create")
+	withoutImage, err := dockertesting.NewServer("127.0.0.1:0", nil, nil)
+	assert.NoError(t, err)
+	defer withoutImage.Stop()
+	withImageClient, _ := docker.NewClient(withImage.URL())
+	withoutImageClient, _ := docker.NewClient(withoutImage.URL())
+	assert.NoError(t, withImageClient.PullImage(docker.PullImageOptions{Repository: "gocd-agent"}, docker.AuthConfiguration{}))
+	e := &Executor{
+		config:      &executor.Config{Env: []string{"FT"}, Resources: []string{"FT"}},
+		dockerImage: "gocd-agent",
+		hostConfig:  &docker.HostConfig{},
+		placement:   placeRoundRobin,
+		pullPolicy:  pullNever,
+		parallelism: 2,
+		hosts:       []*host{{endpoint: withImage.URL(), client: withImageClient}, {endpoint: withoutImage.URL(), client: withoutImageClient}},
+		hostOf:      make(map[string]*host),
+	}
+
+	result, err := e.ScaleUp(4)
+	assert.NoError(t, err)
+	assert.Empty(t, result.Succeeded)
+	assert.Len(t, result.Failed, 4)
+}
@@ -0,0 +1,112 @@
+package docker
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/ind9/vasuki/utils/logging"
+)
+
+// Pull policies of the agent image, same as the ones of Kubernetes
+const (
+	pullAlways       = "always"
+	pullIfNotPresent = "if-not-present"
+	pullNever        = "never"
+)
+
+// Key of Docker Hub in a docker config.json
+const dockerHubRegistry = "https://index.docker.io/v1/"
+
+// ImagePullError - The agent image couldn't be pulled, or isn't present on the Docker host when it
+// mustn't be pulled. No agent can be started until it's fixed.
+type ImagePullError struct {
+	Image string
+	Err   error
+}
+
+func (e *ImagePullError) Error() string {
+	return fmt.Sprintf("docker: image %s is not available - %s", e.Image, e.Err)
+}
+
+// validatePullPolicy - Defaults to pulling the image only when it isn't present
+func validatePullPolicy(policy string) (string, error) {
+	switch policy {
+	case "":
+		return pullIfNotPresent, nil
+	case pullAlways, pullIfNotPresent, pullNever:
+		return policy, nil
+	}
+	return "", fmt.Errorf("docker: unknown pull-policy %q, available policies are always, if-not-present, never", policy)
+}
+
+// registryAuth - Credentials for the registry of the image. Explicit credentials take precedence
+// over the ones in the docker config.json, no credentials are used when neither of them is given.
+func registryAuth(image string, options map[string]string) (docker.AuthConfiguration, error) {
+	registry := registryOf(image)
+	if username := options["registry-username"]; username != "" {
+		return docker.AuthConfiguration{
+			Username:      username,
+			Password:      options["registry-password"],
+			ServerAddress: registry,
+		}, nil
+	}
+	path := options["registry-config"]
+	if path == "" {
+		return docker.AuthConfiguration{}, nil
+	}
+	auths, err := docker.NewAuthConfigurationsFromFile(path)
+	if err != nil {
+		return docker.AuthConfiguration{}, fmt.Errorf("docker: couldn't read the registry credentials from %s - %s", path, err)
+	}
+	auth, present := auths.Configs[registry]
+	if !present {
+		logging.Log.Warningf("%s has no credentials for the registry %s of image %s", path, registry, image)
+	}
+	return auth, nil
+}
+
+// registryOf - Registry the image is pulled from. Like Docker, the first component of the image is
+// taken for a registry only when it looks like a host name.
+func registryOf(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0]
+	}
+	return dockerHubRegistry
+}
+
+// ensureImage - Makes the agent image available on the Docker host as per the pull policy
+func (e *Executor) ensureImage(h *host) error {
+	if e.pullPolicy != pullAlways {
+		_, err := h.client.InspectImage(e.dockerImage)
+		if err == nil {
+			return nil
+		}
+		if err != docker.ErrNoSuchImage {
+			return err
+		}
+		if e.pullPolicy == pullNever {
+			return &ImagePullError{Image: e.dockerImage, Err: fmt.Errorf("it isn't present on the Docker host %s and the pull policy is never", h.endpoint)}
+		}
+	}
+
+	repository, tag := docker.ParseRepositoryTag(e.dockerImage)
+	if tag == "" {
+		tag = "latest"
+	}
+	logging.Log.Infof("Pulling image %s:%s on %s", repository, tag, h.endpoint)
+	var progress bytes.Buffer
+	opts := docker.PullImageOptions{
+		Repository:   repository,
+		Tag:          tag,
+		OutputStream: &progress,
+	}
+	err := h.client.PullImage(opts, e.registryAuth)
+	logging.Log.Debugf("Output of pulling image %s:%s\n%s", repository, tag, progress.String())
+	if err != nil {
+		return &ImagePullError{Image: e.dockerImage, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ind9/vasuki/utils/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	logging.MuteLogs()
+}
+
+func TestValidatePullPolicy(t *testing.T) {
+	policy, err := validatePullPolicy("")
+	assert.NoError(t, err)
+	assert.Equal(t, pullIfNotPresent, policy)
+
+	policy, err = validatePullPolicy("never")
+	assert.NoError(t, err)
+	assert.Equal(t, pullNever, policy)
+
+	_, err = validatePullPolicy("sometimes")
+	assert.Error(t, err)
+}
+
+func TestRegistryOf(t *testing.T) {
+	assert.Equal(t, dockerHubRegistry, registryOf("ashwanthkumar/gocd-agent"))
+	assert.Equal(t, dockerHubRegistry, registryOf("gocd-agent:latest"))
+	assert.Equal(t, "registry.example.com", registryOf("registry.example.com/ci/gocd-agent:17.3"))
+	assert.Equal(t, "localhost:5000", registryOf("localhost:5000/gocd-agent"))
+	assert.Equal(t, "localhost", registryOf("localhost/gocd-agent"))
+}
+
+func TestRegistryAuthPrefersExplicitCredentials(t *testing.T) {
+	auth, err := registryAuth("registry.example.com/gocd-agent", map[string]string{
+		"registry-username": "ci",
+		"registry-password": "secret",
+		"registry-config":   "/does/not/exist",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "ci", auth.Username)
+	assert.Equal(t, "secret", auth.Password)
+	assert.Equal(t, "registry.example.com", auth.ServerAddress)
+}
+
+func TestRegistryAuthFromDockerConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vasuki")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+	// "ci:secret" in base64
+	content := `{"auths": {"registry.example.com": {"auth": "Y2k6c2VjcmV0"}}}`
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+
+	auth, err := registryAuth("registry.example.com/gocd-agent", map[string]string{"registry-config": path})
+	assert.NoError(t, err)
+	assert.Equal(t, "ci", auth.Username)
+	assert.Equal(t, "secret", auth.Password)
+
+	auth, err = registryAuth("gocd-agent", map[string]string{"registry-config": path})
+	assert.NoError(t, err)
+	assert.Empty(t, auth.Username)
+
+	_, err = registryAuth("gocd-agent", map[string]string{"registry-config": filepath.Join(dir, "missing.json")})
+	assert.Error(t, err)
+}
+
+func TestImagePullErrorNamesTheImage(t *testing.T) {
+	err := &ImagePullError{Image: "gocd-agent:17.3", Err: assert.AnError}
+	assert.Contains(t, err.Error(), "gocd-agent:17.3")
+}
@@ -0,0 +1,79 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// tlsFiles - PEM files a Docker endpoint is connected to with over TLS
+type tlsFiles struct {
+	ca   string // Verifies the certificate of the Docker daemon
+	cert string // Client certificate and its key, for daemons that authenticate their clients
+	key  string
+}
+
+// tlsFilesFor - TLS files of each of the endpoints, nil for the ones without TLS. Each of tls-ca, tls-cert
+// and tls-key is either one path for every endpoint, or a comma separated path per endpoint in the same
+// order, left empty for the endpoints without TLS. Every endpoint with TLS is checked, so that a typo
+// doesn't silently fall back to an unverified connection.
+func tlsFilesFor(options map[string]string, endpoints []string) ([]*tlsFiles, error) {
+	var resultErr *multierror.Error
+	cas, err := perEndpoint("tls-ca", options["tls-ca"], len(endpoints))
+	resultErr = updateErrors(resultErr, err)
+	certs, err := perEndpoint("tls-cert", options["tls-cert"], len(endpoints))
+	resultErr = updateErrors(resultErr, err)
+	keys, err := perEndpoint("tls-key", options["tls-key"], len(endpoints))
+	resultErr = updateErrors(resultErr, err)
+	if resultErr.ErrorOrNil() != nil {
+		return nil, resultErr.ErrorOrNil()
+	}
+
+	files := make([]*tlsFiles, len(endpoints))
+	for index, endpoint := range endpoints {
+		ca, cert, key := cas[index], certs[index], keys[index]
+		if ca == "" && cert == "" && key == "" {
+			continue
+		}
+		if !strings.HasPrefix(endpoint, "tcp://") && !strings.HasPrefix(endpoint, "https://") {
+			resultErr = updateErrors(resultErr, fmt.Errorf("docker: TLS is only supported for tcp:// and https:// endpoints, found %s", endpoint))
+		}
+		if ca == "" {
+			resultErr = updateErrors(resultErr, fmt.Errorf("docker: tls-ca is required for %s to verify the Docker daemon", endpoint))
+		}
+		if (cert == "") != (key == "") {
+			resultErr = updateErrors(resultErr, fmt.Errorf("docker: tls-cert and tls-key of %s must be given together", endpoint))
+		}
+		for _, path := range []string{ca, cert, key} {
+			if _, err := os.Stat(path); path != "" && err != nil {
+				resultErr = updateErrors(resultErr, fmt.Errorf("docker: TLS file of %s - %s", endpoint, err))
+			}
+		}
+		files[index] = &tlsFiles{ca: ca, cert: cert, key: key}
+	}
+	if resultErr.ErrorOrNil() != nil {
+		return nil, resultErr.ErrorOrNil()
+	}
+	return files, nil
+}
+
+// perEndpoint - Value of the option for each of the endpoints
+func perEndpoint(option string, value string, endpoints int) ([]string, error) {
+	values := make([]string, endpoints)
+	if value == "" {
+		return values, nil
+	}
+	parts := strings.Split(value, ",")
+	if len(parts) != 1 && len(parts) != endpoints {
+		return nil, fmt.Errorf("docker: %s must have one path for every endpoint, or one per endpoint (%d), found %d", option, endpoints, len(parts))
+	}
+	for index := range values {
+		values[index] = strings.TrimSpace(parts[0])
+		if len(parts) == endpoints {
+			values[index] = strings.TrimSpace(parts[index])
+		}
+	}
+	return values, nil
+}
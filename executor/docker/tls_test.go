@@ -0,0 +1,89 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ind9/vasuki/executor"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTLSFiles - Placeholder ca.pem, cert.pem and key.pem in a new directory
+func writeTLSFiles(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "vasuki")
+	assert.NoError(t, err)
+	for _, name := range []string{"ca.pem", "cert.pem", "key.pem"} {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte("not a certificate"), 0600))
+	}
+	return dir
+}
+
+func TestTLSFilesForEachEndpoint(t *testing.T) {
+	dir := writeTLSFiles(t)
+	defer os.RemoveAll(dir)
+	ca := filepath.Join(dir, "ca.pem")
+	cert := filepath.Join(dir, "cert.pem")
+	key := filepath.Join(dir, "key.pem")
+
+	files, err := tlsFilesFor(map[string]string{"tls-ca": ca, "tls-cert": cert, "tls-key": key},
+		[]string{"tcp://build-1:2376", "tcp://build-2:2376"})
+	assert.NoError(t, err)
+	assert.Equal(t, []*tlsFiles{{ca: ca, cert: cert, key: key}, {ca: ca, cert: cert, key: key}}, files)
+
+	files, err = tlsFilesFor(map[string]string{"tls-ca": ca + ",", "tls-cert": cert + ",", "tls-key": key + ","},
+		[]string{"tcp://build-1:2376", "unix:///var/run/docker.sock"})
+	assert.NoError(t, err)
+	assert.Equal(t, []*tlsFiles{{ca: ca, cert: cert, key: key}, nil}, files)
+
+	files, err = tlsFilesFor(map[string]string{}, []string{"unix:///var/run/docker.sock"})
+	assert.NoError(t, err)
+	assert.Equal(t, []*tlsFiles{nil}, files)
+}
+
+func TestTLSFilesAreValidated(t *testing.T) {
+	dir := writeTLSFiles(t)
+	defer os.RemoveAll(dir)
+	ca := filepath.Join(dir, "ca.pem")
+	endpoints := []string{"tcp://build-1:2376", "tcp://build-2:2376"}
+
+	invalid := []map[string]string{
+		{"tls-ca": ca + "," + ca + "," + ca},                       // more paths than endpoints
+		{"tls-cert": filepath.Join(dir, "cert.pem")},               // no CA
+		{"tls-ca": ca, "tls-cert": filepath.Join(dir, "cert.pem")}, // no key
+		{"tls-ca": filepath.Join(dir, "missing.pem")},
+	}
+	for _, options := range invalid {
+		_, err := tlsFilesFor(options, endpoints)
+		assert.Error(t, err, "%v", options)
+	}
+
+	_, err := tlsFilesFor(map[string]string{"tls-ca": ca}, []string{"unix:///var/run/docker.sock"})
+	assert.Error(t, err)
+}
+
+func TestInitFailsForInvalidCertificates(t *testing.T) {
+	dir := writeTLSFiles(t)
+	defer os.RemoveAll(dir)
+
+	e := &Executor{}
+	err := e.Init(&executor.Config{Additional: map[string]string{
+		"image":    "gocd-agent",
+		"endpoint": "tcp://build-1:2376",
+		"tls-ca":   filepath.Join(dir, "ca.pem"),
+	}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "tcp://build-1:2376")
+}
+
+func TestInitRefusesTLSOptionsWithSettingsFromEnv(t *testing.T) {
+	e := &Executor{}
+	err := e.Init(&executor.Config{Additional: map[string]string{
+		"image":  "gocd-agent",
+		"env":    "true",
+		"tls-ca": "/etc/docker/ca.pem",
+	}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "tls-ca can't be used with env=true")
+}
@@ -0,0 +1,67 @@
+package executor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Result - How each of the agents an executor was asked to start / kill fared
+type Result struct {
+	Succeeded []string         // UUIDs of the agents that were started / killed
+	Failed    map[string]error // Why each of the other agents failed, keyed by its UUID
+}
+
+// Succeed - Records that the agent was started / killed
+func (r *Result) Succeed(agentID string) {
+	r.Succeeded = append(r.Succeeded, agentID)
+}
+
+// Fail - Records why the agent couldn't be started / killed
+func (r *Result) Fail(agentID string, err error) {
+	if r.Failed == nil {
+		r.Failed = make(map[string]error)
+	}
+	r.Failed[agentID] = err
+}
+
+// Err - The failed agents as an AgentsError for the action, nil when none of them failed
+func (r Result) Err(action string) error {
+	if len(r.Failed) == 0 {
+		return nil
+	}
+	return &AgentsError{Action: action, Failed: r.Failed}
+}
+
+// AgentsError - Some of the agents an executor was asked to act on failed, the others succeeded
+type AgentsError struct {
+	Action string           // What was done to the agents, e.g. start
+	Failed map[string]error // Why each agent failed, keyed by its UUID
+}
+
+func (e *AgentsError) Error() string {
+	var reasons []string
+	for _, agentID := range e.Agents() {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", agentID, e.Failed[agentID]))
+	}
+	return fmt.Sprintf("couldn't %s %d agents - %s", e.Action, len(e.Failed), strings.Join(reasons, "; "))
+}
+
+// WrappedErrors - Errors of the failed agents, in the order of Agents
+func (e *AgentsError) WrappedErrors() []error {
+	var errs []error
+	for _, agentID := range e.Agents() {
+		errs = append(errs, e.Failed[agentID])
+	}
+	return errs
+}
+
+// Agents - UUIDs of the agents that failed, in a stable order
+func (e *AgentsError) Agents() []string {
+	agents := make([]string, 0, len(e.Failed))
+	for agentID := range e.Failed {
+		agents = append(agents, agentID)
+	}
+	sort.Strings(agents)
+	return agents
+}
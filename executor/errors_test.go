@@ -0,0 +1,27 @@
+package executor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ind9/vasuki/utils/failures"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAgentsErrorListsTheFailedAgents(t *testing.T) {
+	err := &AgentsError{Action: "start", Failed: map[string]error{
+		"agent-2": errors.New("no space left on device"),
+		"agent-1": errors.New("port is already allocated"),
+	}}
+
+	assert.Equal(t, []string{"agent-1", "agent-2"}, err.Agents())
+	assert.Equal(t, "couldn't start 2 agents - agent-1: port is already allocated; agent-2: no space left on device", err.Error())
+}
+
+func TestAgentsErrorIsFatalWhenAnAgentFailedFatally(t *testing.T) {
+	err := &AgentsError{Action: "start", Failed: map[string]error{"agent-1": errors.New("quota exceeded")}}
+	assert.False(t, failures.IsFatal(err))
+
+	err.Failed["agent-2"] = failures.Fatal(errors.New("forbidden"))
+	assert.True(t, failures.IsFatal(err))
+}
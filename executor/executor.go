@@ -1,5 +1,7 @@
 package executor
 
+import "time"
+
 // Config - Static Configuration for Executor
 type Config struct {
 	ServerHost      string
@@ -13,12 +15,24 @@ type Config struct {
 // Executor -
 type Executor interface {
 	Init(config *Config) error
-	ScaleUp(instances int) error
-	// currentAgents - List of UUIDs of the *idle agents* we know as of now
-	ScaleDown(agentsToKill []string) error
+	// ScaleUp - Starts the # of agents. The error is for a failure that kept all of them from starting, like an
+	// image that can't be pulled. Otherwise the result has the agents that were started and the ones that failed.
+	ScaleUp(instances int) (Result, error)
+	// ScaleDown - Kills the agents, which are the UUIDs of *idle agents* we know as of now. Reports the
+	// same way as ScaleUp.
+	ScaleDown(agentsToKill []string) (Result, error)
 	// Agents that are managed by this Executor instance.
 	ManagedAgents() ([]string, error)
+	// LaunchTimes - When each of the managed agents was launched, keyed by their UUID
+	LaunchTimes() (map[string]time.Time, error)
+	// Logs - Recent output of the agent, used to tell why it never registered
+	Logs(agentID string) (string, error)
 }
 
-// DefaultExecutor instance available across the app
-var DefaultExecutor Executor
+// GarbageCollector - Optionally implemented by executors whose agents can be left behind on the host,
+// like the containers of agents that exited on their own
+type GarbageCollector interface {
+	// CollectGarbage - Removes the managed agents that have exited, and the ones that aren't among the known
+	// agents even though they were launched before the given time. Returns the UUIDs of the removed agents.
+	CollectGarbage(knownAgents []string, launchedBefore time.Time) ([]string, error)
+}
@@ -0,0 +1,256 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/ind9/vasuki/executor"
+	"github.com/ind9/vasuki/utils/failures"
+	"github.com/ind9/vasuki/utils/logging"
+	"github.com/ind9/vasuki/utils/sets"
+	"github.com/satori/go.uuid"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// # of lines of an agent's output that are captured by Logs
+const logLines int64 = 100
+
+// Executor - Kubernetes based Executor implementation, runs every agent as a Pod
+type Executor struct {
+	config    *executor.Config
+	client    kubernetes.Interface
+	image     string
+	namespace string
+}
+
+// Init - Initialize this Executor instance
+func (e *Executor) Init(config *executor.Config) (err error) {
+	e.config = config
+	e.image = config.Additional["image"]
+	if e.image == "" {
+		return fmt.Errorf("kubernetes: image is required")
+	}
+	e.namespace = config.Additional["namespace"]
+	if e.namespace == "" {
+		e.namespace = corev1.NamespaceDefault
+	}
+
+	var restConfig *rest.Config
+	if kubeConfig := config.Additional["config"]; kubeConfig != "" {
+		restConfig, err = clientcmd.BuildConfigFromFlags("", kubeConfig)
+	} else {
+		restConfig, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		return err
+	}
+	e.client, err = kubernetes.NewForConfig(restConfig)
+	return err
+}
+
+// ScaleUp - Initiate a scaleUp activity among the agents that are managed by this executor instance
+func (e *Executor) ScaleUp(instances int) (executor.Result, error) {
+	logging.Log.Infof("Scaling up %d agents via Kubernetes", instances)
+	var result executor.Result
+	for count := 0; count < instances; count++ {
+		agentID := uuid.NewV4().String()
+		_, err := e.client.CoreV1().Pods(e.namespace).Create(context.TODO(), e.podFor(agentID), metav1.CreateOptions{})
+		if err != nil {
+			result.Fail(agentID, classify(err))
+		} else {
+			logging.Log.Debugf("Started agent pod %s", agentID)
+			result.Succeed(agentID)
+		}
+	}
+
+	return result, nil
+}
+
+// ScaleDown - Initiate a scaledown activity among the agents that are managed by this executor instance
+func (e *Executor) ScaleDown(agentsToKill []string) (executor.Result, error) {
+	var result executor.Result
+	for _, agentID := range agentsToKill {
+		pod, err := e.findPodFor(agentID)
+		if err == nil {
+			logging.Log.Infof("Terminating agent %s created via Kubernetes", agentID)
+			err = classify(e.client.CoreV1().Pods(e.namespace).Delete(context.TODO(), pod.Name, metav1.DeleteOptions{}))
+		}
+		if err != nil {
+			result.Fail(agentID, err)
+		} else {
+			result.Succeed(agentID)
+		}
+	}
+	return result, nil
+}
+
+// ManagedAgents - List of UUIDs of the agents that are managed through this executor instance
+func (e *Executor) ManagedAgents() ([]string, error) {
+	pods, err := e.listPods("VASUKI_MANAGED=true")
+	var agentIds []string
+	for _, pod := range pods {
+		if alive(pod) {
+			agentIds = append(agentIds, pod.Labels["GO_AGENT_UUID"])
+		}
+	}
+	return agentIds, err
+}
+
+// LaunchTimes - When each of the agents managed through this executor instance was created
+func (e *Executor) LaunchTimes() (map[string]time.Time, error) {
+	pods, err := e.listPods("VASUKI_MANAGED=true")
+	launchTimes := make(map[string]time.Time, len(pods))
+	for _, pod := range pods {
+		if alive(pod) {
+			launchTimes[pod.Labels["GO_AGENT_UUID"]] = pod.CreationTimestamp.Time
+		}
+	}
+	return launchTimes, err
+}
+
+// CollectGarbage - Deletes the pods we spun whose agent has exited, and the ones whose agent isn't known to the
+// GoCD Server even though they were created before launchedBefore. See executor.GarbageCollector.
+func (e *Executor) CollectGarbage(knownAgents []string, launchedBefore time.Time) ([]string, error) {
+	pods, err := e.listPods("VASUKI_MANAGED=true")
+	if err != nil {
+		return nil, err
+	}
+	known := sets.FromSlice(knownAgents)
+	var resultErr *multierror.Error
+	var removed []string
+	for _, pod := range pods {
+		agentID := pod.Labels["GO_AGENT_UUID"]
+		if pod.DeletionTimestamp != nil {
+			continue
+		} else if !alive(pod) {
+			logging.Log.Infof("Deleting the pod of agent %s that has %s", agentID, strings.ToLower(string(pod.Status.Phase)))
+		} else if !known.Contains(agentID) && pod.CreationTimestamp.Time.Before(launchedBefore) {
+			logging.Log.Infof("Deleting the pod of agent %s that isn't known to the Go Server", agentID)
+		} else {
+			continue
+		}
+		err := classify(e.client.CoreV1().Pods(e.namespace).Delete(context.TODO(), pod.Name, metav1.DeleteOptions{}))
+		if err != nil {
+			resultErr = multierror.Append(resultErr, err)
+		} else {
+			removed = append(removed, agentID)
+		}
+	}
+	return removed, resultErr.ErrorOrNil()
+}
+
+// Logs - Last lines of the output of the agent's pod
+func (e *Executor) Logs(agentID string) (string, error) {
+	pod, err := e.findPodFor(agentID)
+	if err != nil {
+		return "", err
+	}
+	tailLines := logLines
+	output, err := e.client.CoreV1().Pods(e.namespace).GetLogs(pod.Name, &corev1.PodLogOptions{TailLines: &tailLines}).Do(context.TODO()).Raw()
+	return string(output), classify(err)
+}
+
+func (e *Executor) podFor(agentID string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: fmt.Sprintf("gocd-agent-%s", agentID),
+			Labels: map[string]string{
+				"VASUKI_MANAGED": "true", // watermark to find the pods we spun
+				"GO_AGENT_UUID":  agentID,
+			},
+			// Label values can't hold the comma separated lists, so they're kept as annotations
+			Annotations: map[string]string{
+				"ENV":       strings.Join(e.config.Env, ","),
+				"RESOURCES": strings.Join(e.config.Resources, ","),
+			},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			Containers: []corev1.Container{
+				{
+					Name:  "gocd-agent",
+					Image: e.image,
+					Env: []corev1.EnvVar{
+						{Name: "GO_SERVER", Value: e.config.ServerHost},
+						{Name: "GO_SERVER_PORT", Value: fmt.Sprintf("%d", e.config.ServerPort)},
+						{Name: "AGENT_ENVIRONMENTS", Value: strings.Join(e.config.Env, ",")},
+						{Name: "AGENT_RESOURCES", Value: strings.Join(e.config.Resources, ",")},
+						{Name: "AGENT_KEY", Value: e.config.AutoRegisterKey},
+						{Name: "AGENT_GUID", Value: agentID},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (e *Executor) findPodFor(agentID string) (*corev1.Pod, error) {
+	pods, err := e.listPods("VASUKI_MANAGED=true", fmt.Sprintf("GO_AGENT_UUID=%s", agentID))
+	if err != nil {
+		return nil, err
+	}
+	if len(pods) < 1 {
+		return nil, fmt.Errorf("Pod for agent id=%s not found", agentID)
+	}
+
+	return &pods[0], nil
+}
+
+// listPods matching all the selectors that were launched for our environment, resource combination
+func (e *Executor) listPods(selectors ...string) ([]corev1.Pod, error) {
+	opts := metav1.ListOptions{
+		LabelSelector: strings.Join(selectors, ","),
+	}
+	podList, err := e.client.CoreV1().Pods(e.namespace).List(context.TODO(), opts)
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	env := strings.Join(e.config.Env, ",")
+	resources := strings.Join(e.config.Resources, ",")
+	var pods []corev1.Pod
+	for _, pod := range podList.Items {
+		if pod.Annotations["ENV"] == env && pod.Annotations["RESOURCES"] == resources {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+// alive - If the pod still is an agent, i.e. it isn't being deleted and hasn't run to completion. The pods are
+// never restarted, so an agent that exited leaves its pod behind as Succeeded or Failed. Pods that were just
+// created may not have a phase yet.
+func alive(pod corev1.Pod) bool {
+	if pod.DeletionTimestamp != nil {
+		return false
+	}
+	switch pod.Status.Phase {
+	case "", corev1.PodPending, corev1.PodRunning:
+		return true
+	}
+	return false
+}
+
+// classify - Missing permissions or credentials won't fix themselves, so they're fatal
+func classify(err error) error {
+	if apierrors.IsUnauthorized(err) || apierrors.IsForbidden(err) {
+		return failures.Fatal(err)
+	}
+	return err
+}
+
+func init() {
+	executor.Register("kubernetes", func() executor.Executor { return &Executor{} },
+		executor.Option{Name: "image", Default: "ashwanthkumar/gocd-agent", Usage: "Docker image used for the agent pods"},
+		executor.Option{Name: "namespace", Default: corev1.NamespaceDefault, Usage: "Namespace in which the agent pods are created"},
+		executor.Option{Name: "config", Usage: "Path to the kubeconfig file. Uses the in-cluster configuration when empty"},
+	)
+}
@@ -0,0 +1,167 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ind9/vasuki/executor"
+	"github.com/ind9/vasuki/utils/logging"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func init() {
+	logging.MuteLogs()
+}
+
+func newTestExecutor(env []string, resources []string) *Executor {
+	return &Executor{
+		config: &executor.Config{
+			ServerHost:      "localhost",
+			ServerPort:      8153,
+			AutoRegisterKey: "123456ABCDEFG",
+			Env:             env,
+			Resources:       resources,
+		},
+		client:    fake.NewSimpleClientset(),
+		image:     "ashwanthkumar/gocd-agent",
+		namespace: "gocd",
+	}
+}
+
+func TestScaleUpCreatesOnePodPerAgent(t *testing.T) {
+	e := newTestExecutor([]string{"FT"}, []string{"FT", "chrome"})
+
+	result, err := e.ScaleUp(2)
+	assert.NoError(t, err)
+	assert.Len(t, result.Succeeded, 2)
+	assert.Empty(t, result.Failed)
+
+	pods, err := e.client.CoreV1().Pods("gocd").List(context.TODO(), metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, pods.Items, 2)
+	for _, pod := range pods.Items {
+		assert.Equal(t, "true", pod.Labels["VASUKI_MANAGED"])
+		assert.Equal(t, "FT", pod.Annotations["ENV"])
+		assert.Equal(t, "FT,chrome", pod.Annotations["RESOURCES"])
+		assert.Equal(t, "ashwanthkumar/gocd-agent", pod.Spec.Containers[0].Image)
+		assert.Contains(t, pod.Spec.Containers[0].Env, envVar("AGENT_GUID", pod.Labels["GO_AGENT_UUID"]))
+	}
+}
+
+func TestManagedAgentsOnlyListsOurEnvAndResources(t *testing.T) {
+	e := newTestExecutor([]string{"FT"}, []string{"FT"})
+	another := newTestExecutor([]string{"UAT"}, []string{"FT"})
+	another.client = e.client
+
+	scaleUp(t, e, 2)
+	scaleUp(t, another, 1)
+
+	agents, err := e.ManagedAgents()
+	assert.NoError(t, err)
+	assert.Len(t, agents, 2)
+
+	agents, err = another.ManagedAgents()
+	assert.NoError(t, err)
+	assert.Len(t, agents, 1)
+}
+
+func TestScaleDownDeletesThePodOfTheAgent(t *testing.T) {
+	e := newTestExecutor([]string{"FT"}, []string{"FT"})
+	scaleUp(t, e, 2)
+	agents, _ := e.ManagedAgents()
+
+	result, err := e.ScaleDown(agents[0:1])
+	assert.NoError(t, err)
+	assert.Equal(t, agents[0:1], result.Succeeded)
+
+	remaining, err := e.ManagedAgents()
+	assert.NoError(t, err)
+	assert.Len(t, remaining, 1)
+	assert.NotContains(t, remaining, agents[0])
+}
+
+func TestScaleDownFailsForUnknownAgent(t *testing.T) {
+	e := newTestExecutor([]string{"FT"}, []string{"FT"})
+
+	result, err := e.ScaleDown([]string{"unknown-agent-id"})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Succeeded)
+	assert.Error(t, result.Failed["unknown-agent-id"])
+}
+
+func scaleUp(t *testing.T, e *Executor, instances int) {
+	result, err := e.ScaleUp(instances)
+	assert.NoError(t, err)
+	assert.Len(t, result.Succeeded, instances)
+}
+
+func envVar(name string, value string) corev1.EnvVar {
+	return corev1.EnvVar{Name: name, Value: value}
+}
+
+func TestLaunchTimesAndLogsOfTheManagedAgents(t *testing.T) {
+	e := newTestExecutor([]string{"FT"}, []string{"FT"})
+	scaleUp(t, e, 1)
+	agents, _ := e.ManagedAgents()
+
+	launchTimes, err := e.LaunchTimes()
+	assert.NoError(t, err)
+	assert.Len(t, launchTimes, 1)
+	assert.Contains(t, launchTimes, agents[0])
+
+	logs, err := e.Logs(agents[0])
+	assert.NoError(t, err)
+	assert.NotEmpty(t, logs)
+
+	_, err = e.Logs("unknown-agent")
+	assert.Error(t, err)
+}
+
+func TestFinishedPodsAreNotManagedAgents(t *testing.T) {
+	e := newTestExecutor([]string{"FT"}, []string{"FT"})
+	scaleUp(t, e, 3)
+	agents, _ := e.ManagedAgents()
+	setPhase(t, e, agents[0], corev1.PodSucceeded)
+	setPhase(t, e, agents[1], corev1.PodRunning)
+
+	managed, err := e.ManagedAgents()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, agents[1:], managed)
+
+	launchTimes, err := e.LaunchTimes()
+	assert.NoError(t, err)
+	assert.Len(t, launchTimes, 2)
+	assert.NotContains(t, launchTimes, agents[0])
+}
+
+func TestCollectGarbageDeletesFinishedAndOrphanedPods(t *testing.T) {
+	e := newTestExecutor([]string{"FT"}, []string{"FT"})
+	scaleUp(t, e, 3)
+	agents, _ := e.ManagedAgents()
+	setPhase(t, e, agents[0], corev1.PodFailed)
+	setPhase(t, e, agents[1], corev1.PodRunning)
+	setPhase(t, e, agents[2], corev1.PodRunning)
+
+	// agents[2] isn't known to the Go Server, but it's within the grace period
+	removed, err := e.CollectGarbage(agents[1:2], time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, agents[0:1], removed)
+
+	removed, err = e.CollectGarbage(agents[1:2], time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, agents[2:3], removed)
+	remaining, _ := e.ManagedAgents()
+	assert.Equal(t, agents[1:2], remaining)
+}
+
+func setPhase(t *testing.T, e *Executor, agentID string, phase corev1.PodPhase) {
+	pod, err := e.findPodFor(agentID)
+	assert.NoError(t, err)
+	pod.Status.Phase = phase
+	_, err = e.client.CoreV1().Pods(e.namespace).Update(context.TODO(), pod, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+}
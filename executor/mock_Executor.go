@@ -1,6 +1,10 @@
 package executor
 
-import "github.com/stretchr/testify/mock"
+import (
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
 
 type MockExecutor struct {
 	mock.Mock
@@ -21,31 +25,45 @@ func (_m *MockExecutor) Init(config *Config) error {
 }
 
 // ScaleUp provides a mock function with given fields: instances
-func (_m *MockExecutor) ScaleUp(instances int) error {
+func (_m *MockExecutor) ScaleUp(instances int) (Result, error) {
 	ret := _m.Called(instances)
 
-	var r0 error
-	if rf, ok := ret.Get(0).(func(int) error); ok {
+	var r0 Result
+	if rf, ok := ret.Get(0).(func(int) Result); ok {
 		r0 = rf(instances)
 	} else {
-		r0 = ret.Error(0)
+		r0 = ret.Get(0).(Result)
 	}
 
-	return r0
+	var r1 error
+	if rf, ok := ret.Get(1).(func(int) error); ok {
+		r1 = rf(instances)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
 
 // ScaleDown provides a mock function with given fields: agentsToKill
-func (_m *MockExecutor) ScaleDown(agentsToKill []string) error {
+func (_m *MockExecutor) ScaleDown(agentsToKill []string) (Result, error) {
 	ret := _m.Called(agentsToKill)
 
-	var r0 error
-	if rf, ok := ret.Get(0).(func([]string) error); ok {
+	var r0 Result
+	if rf, ok := ret.Get(0).(func([]string) Result); ok {
 		r0 = rf(agentsToKill)
 	} else {
-		r0 = ret.Error(0)
+		r0 = ret.Get(0).(Result)
 	}
 
-	return r0
+	var r1 error
+	if rf, ok := ret.Get(1).(func([]string) error); ok {
+		r1 = rf(agentsToKill)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
 
 // ManagedAgents provides a mock function with given fields:
@@ -70,3 +88,47 @@ func (_m *MockExecutor) ManagedAgents() ([]string, error) {
 
 	return r0, r1
 }
+
+// LaunchTimes provides a mock function with given fields:
+func (_m *MockExecutor) LaunchTimes() (map[string]time.Time, error) {
+	ret := _m.Called()
+
+	var r0 map[string]time.Time
+	if rf, ok := ret.Get(0).(func() map[string]time.Time); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]time.Time)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Logs provides a mock function with given fields: agentID
+func (_m *MockExecutor) Logs(agentID string) (string, error) {
+	ret := _m.Called(agentID)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(string) string); ok {
+		r0 = rf(agentID)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(agentID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
@@ -0,0 +1,34 @@
+package executor
+
+import (
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+type MockGarbageCollector struct {
+	mock.Mock
+}
+
+// CollectGarbage provides a mock function with given fields: knownAgents, launchedBefore
+func (_m *MockGarbageCollector) CollectGarbage(knownAgents []string, launchedBefore time.Time) ([]string, error) {
+	ret := _m.Called(knownAgents, launchedBefore)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func([]string, time.Time) []string); ok {
+		r0 = rf(knownAgents, launchedBefore)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func([]string, time.Time) error); ok {
+		r1 = rf(knownAgents, launchedBefore)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
@@ -0,0 +1,66 @@
+package executor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Factory - Creates a new uninitialized Executor instance
+type Factory func() Executor
+
+// Option - Setting specific to an Executor implementation. It is exposed as the
+// `--<executor>-<name>` flag and handed over to the executor via Config.Additional[name]
+type Option struct {
+	Name    string
+	Usage   string
+	Default string
+	Boolean bool // Option is a switch and holds either "true" or "false"
+	Secret  bool // Option holds a credential, so its value is never reported back
+}
+
+type registration struct {
+	factory Factory
+	options []Option
+}
+
+var registry = make(map[string]*registration)
+
+// Register - Makes an Executor implementation available under the given name.
+// Meant to be called from the init() of the implementation's package.
+func Register(name string, factory Factory, options ...Option) {
+	if _, present := registry[name]; present {
+		panic(fmt.Sprintf("executor %s is already registered", name))
+	}
+	registry[name] = &registration{
+		factory: factory,
+		options: options,
+	}
+}
+
+// New - Creates a new instance of the executor registered under the name
+func New(name string) (Executor, error) {
+	r, present := registry[name]
+	if !present {
+		return nil, fmt.Errorf("Unknown executor %q, available executors are %s", name, strings.Join(Names(), ", "))
+	}
+	return r.factory(), nil
+}
+
+// Options - Settings supported by the executor registered under the name
+func Options(name string) []Option {
+	if r, present := registry[name]; present {
+		return r.options
+	}
+	return nil
+}
+
+// Names - Sorted names of all the registered executors
+func Names() []string {
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,33 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterAndCreateExecutor(t *testing.T) {
+	Register("test-mock", func() Executor { return new(MockExecutor) }, Option{Name: "image", Default: "foo"})
+	defer delete(registry, "test-mock")
+
+	instance, err := New("test-mock")
+	assert.NoError(t, err)
+	assert.IsType(t, &MockExecutor{}, instance)
+	assert.Equal(t, []Option{{Name: "image", Default: "foo"}}, Options("test-mock"))
+	assert.Contains(t, Names(), "test-mock")
+}
+
+func TestNewFailsForUnknownExecutor(t *testing.T) {
+	_, err := New("unknown")
+	assert.Error(t, err)
+	assert.Nil(t, Options("unknown"))
+}
+
+func TestRegisterPanicsOnDuplicateName(t *testing.T) {
+	Register("test-duplicate", func() Executor { return new(MockExecutor) })
+	defer delete(registry, "test-duplicate")
+
+	assert.Panics(t, func() {
+		Register("test-duplicate", func() Executor { return new(MockExecutor) })
+	})
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import "github.com/ashwanthkumar/go-gocd"
+
+// Client - gocd.Client that counts the failed calls Vasuki makes to the GoCD API by endpoint
+type Client struct {
+	gocd.Client
+}
+
+// InstrumentClient - Wraps the client to count its errors
+func InstrumentClient(client gocd.Client) gocd.Client {
+	return &Client{Client: client}
+}
+
+// GetAllAgents - Instrumented gocd.Client implementation
+func (c *Client) GetAllAgents() ([]*gocd.Agent, error) {
+	agents, err := c.Client.GetAllAgents()
+	return agents, count("GetAllAgents", err)
+}
+
+// GetAgent - Instrumented gocd.Client implementation
+func (c *Client) GetAgent(uuid string) (*gocd.Agent, error) {
+	agent, err := c.Client.GetAgent(uuid)
+	return agent, count("GetAgent", err)
+}
+
+// DisableAgent - Instrumented gocd.Client implementation
+func (c *Client) DisableAgent(uuid string) error {
+	return count("DisableAgent", c.Client.DisableAgent(uuid))
+}
+
+// EnableAgent - Instrumented gocd.Client implementation
+func (c *Client) EnableAgent(uuid string) error {
+	return count("EnableAgent", c.Client.EnableAgent(uuid))
+}
+
+// DeleteAgent - Instrumented gocd.Client implementation
+func (c *Client) DeleteAgent(uuid string) error {
+	return count("DeleteAgent", c.Client.DeleteAgent(uuid))
+}
+
+// AgentRunJobHistory - Instrumented gocd.Client implementation
+func (c *Client) AgentRunJobHistory(uuid string, offset int) ([]*gocd.JobHistory, error) {
+	jobs, err := c.Client.AgentRunJobHistory(uuid, offset)
+	return jobs, count("AgentRunJobHistory", err)
+}
+
+// GetScheduledJobs - Instrumented gocd.Client implementation
+func (c *Client) GetScheduledJobs() ([]*gocd.ScheduledJob, error) {
+	jobs, err := c.Client.GetScheduledJobs()
+	return jobs, count("GetScheduledJobs", err)
+}
+
+func count(endpoint string, err error) error {
+	if err != nil {
+		GoCDErrors.WithLabelValues(endpoint).Inc()
+	}
+	return err
+}
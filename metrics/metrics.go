@@ -0,0 +1,27 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func init() {
+	prometheus.MustRegister(Demand, QueuedJobs, BuildingAgents, Supply, IdleAgents, MaxAgents,
+		ScaledUp, ScaledDown, GarbageCollected, Recycled, ExecutorFailures, ReconcileDuration, GoCDErrors)
+}
+
+// Handler - Serves every registered metric in the Prometheus text format, along with the metrics of the
+// Go runtime and the process
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// AddCount - Adds the growth of a total to the counter for the label values. A total that went down, like
+// the one of a pool that was recreated, adds nothing as counters only go up.
+func AddCount(counter *prometheus.CounterVec, delta int, labelValues ...string) {
+	if delta > 0 {
+		counter.WithLabelValues(labelValues...).Add(float64(delta))
+	}
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ashwanthkumar/go-gocd"
+	gocdmocks "github.com/ashwanthkumar/go-gocd/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func scrape() string {
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	return recorder.Body.String()
+}
+
+func TestHandlerServesTheMetricsOfThePools(t *testing.T) {
+	Demand.WithLabelValues("ft").Set(2)
+	ReconcileDuration.WithLabelValues("ft").Observe(0.75)
+
+	output := scrape()
+	assert.Contains(t, output, "# TYPE vasuki_demand gauge\nvasuki_demand{pool=\"ft\"} 2\n")
+	assert.Contains(t, output, "vasuki_reconcile_duration_seconds_bucket{pool=\"ft\",le=\"1\"} 1\n")
+	assert.Contains(t, output, "vasuki_reconcile_duration_seconds_count{pool=\"ft\"} 1\n")
+}
+
+func TestAddCountOnlyAddsTheGrowth(t *testing.T) {
+	AddCount(ExecutorFailures, 3, "uat", "scale-up")
+	AddCount(ExecutorFailures, -1, "uat", "scale-up")
+	AddCount(ExecutorFailures, 0, "uat", "scale-down")
+
+	output := scrape()
+	assert.Contains(t, output, "vasuki_executor_failures_total{action=\"scale-up\",pool=\"uat\"} 3\n")
+	assert.NotContains(t, output, "vasuki_executor_failures_total{action=\"scale-down\",pool=\"uat\"}")
+}
+
+func TestInstrumentedClientCountsErrorsByEndpoint(t *testing.T) {
+	mockClient := new(gocdmocks.Client)
+	mockClient.On("GetScheduledJobs").Return([]*gocd.ScheduledJob{}, errors.New("GoCD is down"))
+	mockClient.On("GetAllAgents").Return([]*gocd.Agent{}, nil)
+	mockClient.On("AgentRunJobHistory", "agent-1", 0).Return([]*gocd.JobHistory{}, errors.New("GoCD is down"))
+	client := InstrumentClient(mockClient)
+
+	_, err := client.GetScheduledJobs()
+	assert.Error(t, err)
+	_, err = client.GetAllAgents()
+	assert.NoError(t, err)
+	_, err = client.AgentRunJobHistory("agent-1", 0)
+	assert.Error(t, err)
+
+	output := scrape()
+	assert.Contains(t, output, "vasuki_gocd_api_errors_total{endpoint=\"GetScheduledJobs\"} 1\n")
+	assert.Contains(t, output, "vasuki_gocd_api_errors_total{endpoint=\"AgentRunJobHistory\"} 1\n")
+	assert.NotContains(t, output, "endpoint=\"GetAllAgents\"")
+}
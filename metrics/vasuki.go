@@ -0,0 +1,34 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Metrics of every pool, updated after each reconcile
+var (
+	Demand         = newGauge("vasuki_demand", "Jobs that are queued or building, excluding the warm pool", "pool")
+	QueuedJobs     = newGauge("vasuki_queued_jobs", "Jobs waiting for an agent", "pool")
+	BuildingAgents = newGauge("vasuki_building_agents", "Agents that are building a job", "pool")
+	Supply         = newGauge("vasuki_supply", "Agents that are registered with the GoCD Server or managed by the executor", "pool")
+	IdleAgents     = newGauge("vasuki_idle_agents", "Agents that are idle", "pool")
+	MaxAgents      = newGauge("vasuki_max_agents", "Maximum number of agents of the pool", "pool")
+
+	ScaledUp          = newCounter("vasuki_agents_scaled_up_total", "Agents that were scaled up", "pool")
+	ScaledDown        = newCounter("vasuki_agents_scaled_down_total", "Agents that were scaled down", "pool")
+	GarbageCollected  = newCounter("vasuki_agents_garbage_collected_total", "Agents left behind by the executor that were removed", "pool")
+	Recycled          = newCounter("vasuki_agents_recycled_total", "Agents that were replaced for being older than the max lifetime", "pool")
+	ExecutorFailures  = newCounter("vasuki_executor_failures_total", "Failed calls to the executor by action (scale-up / scale-down)", "pool", "action")
+	ReconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "vasuki_reconcile_duration_seconds",
+		Help:    "Time taken to reconcile a pool",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"pool"})
+
+	GoCDErrors = newCounter("vasuki_gocd_api_errors_total", "Failed calls to the GoCD API by endpoint", "endpoint")
+)
+
+func newGauge(name string, help string, labelNames ...string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labelNames)
+}
+
+func newCounter(name string, help string, labelNames ...string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labelNames)
+}
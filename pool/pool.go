@@ -0,0 +1,244 @@
+package pool
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ashwanthkumar/go-gocd"
+	"github.com/ind9/vasuki/executor"
+	"github.com/ind9/vasuki/metrics"
+	"github.com/ind9/vasuki/scalar"
+	"github.com/ind9/vasuki/utils/backoff"
+	"github.com/ind9/vasuki/utils/failures"
+	"github.com/ind9/vasuki/utils/logging"
+)
+
+// Config - Settings of a named pool of agents
+type Config struct {
+	Name         string
+	PollInterval time.Duration
+	MaxBackoff   time.Duration // Upper bound of the delay between retries of a failing pool
+	Scalar       *scalar.Config
+	// Built in scaling policy of the pool along with its parameters, see scalar.NewScalingPolicy
+	ScalingPolicy string
+	ScalingStep   int
+	ScalingFactor float64
+	Executor      string
+	// Env and Resources of the executor are always taken from the Scalar config
+	ExecutorConfig *executor.Config
+}
+
+// Pool - Agents of an env / resource combination that are scaled independently of other pools
+type Pool struct {
+	config        *Config
+	scalar        scalar.Scalar
+	executor      executor.Executor
+	backoff       *backoff.Exponential
+	totalFailures int
+	trigger       chan struct{} // Wakes up Run to reconcile without waiting for the poll interval
+
+	// Guards the fields below, they're read by the HTTP API while the pool runs
+	mutex       sync.Mutex
+	paused      bool
+	status      scalar.Status
+	lastError   error
+	lastErrorAt time.Time
+}
+
+// Status - Settings and state of a pool as reported by the HTTP API
+type Status struct {
+	Name     string            `json:"name"`
+	Settings map[string]string `json:"settings"`
+	Paused   bool              `json:"paused"`
+	scalar.Status
+	ManagedAgents      []string  `json:"managed-agents"`
+	ManagedAgentsError string    `json:"managed-agents-error,omitempty"`
+	LastError          string    `json:"last-error,omitempty"`
+	LastErrorAt        time.Time `json:"last-error-at"`
+}
+
+// New - Creates a new Pool instance along with its own executor
+func New(config *Config, client gocd.Client) (*Pool, error) {
+	if err := config.Scalar.Validate(); err != nil {
+		return nil, fmt.Errorf("pool %s: %s", config.Name, err)
+	}
+	policy, err := scalar.NewScalingPolicy(config.ScalingPolicy, config.ScalingStep, config.ScalingFactor)
+	if err != nil {
+		return nil, fmt.Errorf("pool %s: %s", config.Name, err)
+	}
+	config.Scalar.Policy = policy
+	executorImpl, err := executor.New(config.Executor)
+	if err != nil {
+		return nil, fmt.Errorf("pool %s: %s", config.Name, err)
+	}
+	config.ExecutorConfig.Env = config.Scalar.Env
+	config.ExecutorConfig.Resources = config.Scalar.Resources
+	if err = executorImpl.Init(config.ExecutorConfig); err != nil {
+		return nil, fmt.Errorf("pool %s: %s", config.Name, err)
+	}
+
+	scalarImpl, err := scalar.NewSimpleScalar(config.Scalar, client, executorImpl)
+	if err != nil {
+		return nil, fmt.Errorf("pool %s: %s", config.Name, err)
+	}
+
+	return &Pool{
+		config:   config,
+		scalar:   scalarImpl,
+		executor: executorImpl,
+		backoff:  &backoff.Exponential{Initial: config.PollInterval, Max: config.MaxBackoff},
+		trigger:  make(chan struct{}, 1),
+	}, nil
+}
+
+// Name of the pool
+func (p *Pool) Name() string {
+	return p.config.Name
+}
+
+// Run - Reconciles the pool on every poll interval, or when triggered, until stopped. Transient
+// errors are retried with an exponential backoff, a fatal error stops the pool and is returned.
+// Returns nil when the pool was stopped via the channel.
+func (p *Pool) Run(stop <-chan struct{}) error {
+	logging.Log.Infof("[%s] Starting pool with Env=%v, Resources=%v", p.Name(), p.config.Scalar.Env, p.config.Scalar.Resources)
+	for {
+		delay := p.config.PollInterval
+		if p.Paused() {
+			logging.Log.Debugf("[%s] Pool is paused, not reconciling", p.Name())
+		} else if err := p.Reconcile(); err != nil {
+			if failures.IsFatal(err) {
+				return err
+			}
+			p.totalFailures++
+			delay = p.backoff.Next()
+			logging.Log.Warningf("[%s] Reconcile failed (%d in a row, %d in total), retrying in %s: %s",
+				p.Name(), p.backoff.Attempts(), p.totalFailures, delay, err)
+		} else {
+			p.backoff.Reset()
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-p.trigger:
+			logging.Log.Infof("[%s] Reconciling on request", p.Name())
+		case <-stop:
+			logging.Log.Infof("[%s] Stopping pool", p.Name())
+			if err := scalar.CancelScaleDown(p.scalar); err != nil {
+				logging.Log.Warningf("[%s] Couldn't enable back the agents disabled to scale down: %s", p.Name(), err)
+			}
+			return nil
+		}
+	}
+}
+
+// Reconcile - Brings the supply of the pool in line with its demand once. A panic
+// while doing so is reported as an error so it can't take down other pools.
+func (p *Pool) Reconcile() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("pool %s: recovered from panic: %v", p.Name(), r)
+		}
+	}()
+
+	start := time.Now()
+	err = scalar.Execute(p.scalar)
+	metrics.ReconcileDuration.WithLabelValues(p.Name()).Observe(time.Since(start).Seconds())
+	p.record(scalar.CurrentStatus(p.scalar), err)
+	if err != nil {
+		wrapped := fmt.Errorf("pool %s: %s", p.Name(), err)
+		if failures.IsFatal(err) {
+			return failures.Fatal(wrapped)
+		}
+		return wrapped
+	}
+	return nil
+}
+
+// Drain - Removes all the agents of the pool once they're done building, see scalar.Drain.
+// Must only be called after the pool has stopped running.
+func (p *Pool) Drain(timeout time.Duration) error {
+	logging.Log.Infof("[%s] Draining pool", p.Name())
+	if err := scalar.Drain(p.scalar, timeout); err != nil {
+		return fmt.Errorf("pool %s: %s", p.Name(), err)
+	}
+	return nil
+}
+
+// Pause - Stops scaling the pool until it's resumed, its agents are left as they are
+func (p *Pool) Pause() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.paused = true
+}
+
+// Resume - Resumes scaling a paused pool
+func (p *Pool) Resume() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.paused = false
+}
+
+// Paused - If scaling of the pool is paused
+func (p *Pool) Paused() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.paused
+}
+
+// Trigger - Asks a running pool to reconcile right away instead of waiting for the poll interval.
+// Triggers that arrive while one is already pending are merged into it.
+func (p *Pool) Trigger() {
+	select {
+	case p.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Status - Settings of the pool, the outcome of its last reconcile and the agents its executor manages
+func (p *Pool) Status() Status {
+	p.mutex.Lock()
+	status := Status{
+		Name:     p.Name(),
+		Settings: redactSecrets(p.config.Executor, p.config.Settings()),
+		Paused:   p.paused,
+		Status:   p.status,
+	}
+	if p.lastError != nil {
+		status.LastError = p.lastError.Error()
+		status.LastErrorAt = p.lastErrorAt
+	}
+	p.mutex.Unlock()
+
+	agents, err := p.executor.ManagedAgents()
+	status.ManagedAgents = agents
+	if err != nil {
+		status.ManagedAgentsError = err.Error()
+	}
+	return status
+}
+
+// record - Keeps the status of the last reconcile for the HTTP API and exports it as metrics
+func (p *Pool) record(status scalar.Status, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	name := p.Name()
+	metrics.Demand.WithLabelValues(name).Set(float64(status.Demand))
+	metrics.QueuedJobs.WithLabelValues(name).Set(float64(status.Queued))
+	metrics.BuildingAgents.WithLabelValues(name).Set(float64(status.Building))
+	metrics.Supply.WithLabelValues(name).Set(float64(status.Supply))
+	metrics.IdleAgents.WithLabelValues(name).Set(float64(status.Idle))
+	metrics.MaxAgents.WithLabelValues(name).Set(float64(p.config.Scalar.MaxAgents))
+	// The status has totals since the pool started, the counters only get what changed since the last reconcile
+	metrics.AddCount(metrics.ScaledUp, status.ScaledUp-p.status.ScaledUp, name)
+	metrics.AddCount(metrics.ScaledDown, status.ScaledDown-p.status.ScaledDown, name)
+	metrics.AddCount(metrics.GarbageCollected, status.GarbageCollected-p.status.GarbageCollected, name)
+	metrics.AddCount(metrics.Recycled, status.Recycled-p.status.Recycled, name)
+	metrics.AddCount(metrics.ExecutorFailures, status.ScaleUpFailures-p.status.ScaleUpFailures, name, "scale-up")
+	metrics.AddCount(metrics.ExecutorFailures, status.ScaleDownFailures-p.status.ScaleDownFailures, name, "scale-down")
+	p.status = status
+	if err != nil {
+		p.lastError = err
+		p.lastErrorAt = time.Now()
+	}
+}
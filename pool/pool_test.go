@@ -0,0 +1,194 @@
+package pool
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ashwanthkumar/go-gocd"
+	gocdmocks "github.com/ashwanthkumar/go-gocd/mocks"
+	"github.com/ind9/vasuki/executor"
+	"github.com/ind9/vasuki/scalar"
+	"github.com/ind9/vasuki/utils/backoff"
+	"github.com/ind9/vasuki/utils/failures"
+	"github.com/ind9/vasuki/utils/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	logging.MuteLogs()
+}
+
+// newTestScalar - SimpleScalar whose GoCD Server has neither demand nor supply, unless GetScheduledJobs fails with err
+func newTestScalar(err error) scalar.Scalar {
+	client := new(gocdmocks.Client)
+	client.On("GetScheduledJobs").Return([]*gocd.ScheduledJob{}, err)
+	client.On("GetAllAgents").Return([]*gocd.Agent{}, nil)
+
+	s, _ := scalar.NewSimpleScalar(scalar.NewConfig([]string{}, []string{}, 1), client, newTestExecutor())
+	return s
+}
+
+func newTestExecutor() *executor.MockExecutor {
+	mockExecutor := new(executor.MockExecutor)
+	mockExecutor.On("ManagedAgents").Return([]string{"agent-1"}, nil)
+	return mockExecutor
+}
+
+func newTestPool(s scalar.Scalar) *Pool {
+	config := testDefaults("test")
+	config.Name = "test-pool"
+	config.PollInterval = 10 * time.Millisecond
+	return &Pool{
+		config:   config,
+		scalar:   s,
+		executor: newTestExecutor(),
+		backoff:  &backoff.Exponential{Initial: config.PollInterval, Max: config.PollInterval},
+		trigger:  make(chan struct{}, 1),
+	}
+}
+
+func TestNewInitializesTheExecutorOfThePool(t *testing.T) {
+	config := testDefaults("test")
+	config.Scalar.Env = []string{"FT"}
+
+	p, err := New(config, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"FT"}, config.ExecutorConfig.Env)
+	assert.NotNil(t, p.scalar)
+}
+
+func TestNewFailsForInvalidScalarConfig(t *testing.T) {
+	config := testDefaults("test")
+	config.Scalar.MinAgents = 2
+
+	_, err := New(config, nil)
+	assert.Error(t, err)
+}
+
+func TestNewSetsTheScalingPolicyOfThePool(t *testing.T) {
+	config := testDefaults("test")
+	config.ScalingPolicy = "fixed-step"
+	config.ScalingStep = 2
+
+	_, err := New(config, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &scalar.FixedStep{Step: 2}, config.Scalar.Policy)
+
+	config.ScalingPolicy = "exponential"
+	_, err = New(config, nil)
+	assert.Error(t, err)
+}
+
+func TestReconcileReportsErrorsWithThePoolName(t *testing.T) {
+	s := newTestScalar(errors.New("GoCD is down"))
+
+	err := newTestPool(s).Reconcile()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "test-pool")
+}
+
+func TestReconcileRecoversFromPanics(t *testing.T) {
+	s := new(scalar.MockScalar) // no expectations, so the first call panics
+
+	err := newTestPool(s).Reconcile()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "panic")
+}
+
+func TestRunStopsWhenAskedTo(t *testing.T) {
+	s := newTestScalar(nil)
+
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- newTestPool(s).Run(stop)
+	}()
+	time.Sleep(30 * time.Millisecond)
+	close(stop)
+
+	assert.NoError(t, <-done)
+}
+
+func TestRunRetriesTransientErrors(t *testing.T) {
+	s := newTestScalar(errors.New("GoCD is down"))
+
+	p := newTestPool(s)
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- p.Run(stop)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+
+	assert.NoError(t, <-done)
+	assert.True(t, p.totalFailures > 1)
+}
+
+func TestRunStopsOnFatalErrors(t *testing.T) {
+	s := newTestScalar(failures.Fatal(errors.New("forbidden")))
+
+	err := newTestPool(s).Run(make(chan struct{}))
+	assert.Error(t, err)
+	assert.True(t, failures.IsFatal(err))
+}
+
+func TestStatusReportsTheLastReconcile(t *testing.T) {
+	p := newTestPool(newTestScalar(errors.New("GoCD is down")))
+
+	assert.Error(t, p.Reconcile())
+	status := p.Status()
+	assert.Equal(t, "test-pool", status.Name)
+	assert.Equal(t, "test", status.Settings["executor"])
+	assert.Contains(t, status.LastError, "GoCD is down")
+	assert.False(t, status.LastErrorAt.IsZero())
+	assert.Equal(t, []string{"agent-1"}, status.ManagedAgents)
+}
+
+func TestStatusRedactsSecretSettings(t *testing.T) {
+	p := newTestPool(newTestScalar(nil))
+	p.config.ExecutorConfig.Additional["password"] = "badger"
+
+	status := p.Status()
+	assert.Equal(t, "<redacted>", status.Settings["password"])
+	assert.Equal(t, "default-image", status.Settings["image"])
+	assert.Equal(t, "badger", p.config.Settings()["password"])
+}
+
+func TestPausedPoolsAreNotReconciled(t *testing.T) {
+	p := newTestPool(newTestScalar(errors.New("GoCD is down")))
+	p.Pause()
+	assert.True(t, p.Paused())
+
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- p.Run(stop)
+	}()
+	time.Sleep(30 * time.Millisecond)
+	close(stop)
+
+	assert.NoError(t, <-done)
+	assert.Equal(t, 0, p.totalFailures)
+	p.Resume()
+	assert.False(t, p.Paused())
+}
+
+func TestTriggerReconcilesRightAway(t *testing.T) {
+	p := newTestPool(newTestScalar(errors.New("GoCD is down")))
+	p.config.PollInterval = time.Hour
+	p.backoff = &backoff.Exponential{Initial: time.Hour, Max: time.Hour}
+
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- p.Run(stop)
+	}()
+	p.Trigger()
+	time.Sleep(30 * time.Millisecond)
+	close(stop)
+
+	assert.NoError(t, <-done)
+	assert.Equal(t, 2, p.totalFailures)
+}
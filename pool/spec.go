@@ -0,0 +1,160 @@
+package pool
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ind9/vasuki/executor"
+)
+
+// Value reported in place of a secret setting
+const redacted = "<redacted>"
+
+// ParseSpec - Parses a pool definition of the form
+// `<name>:env=FT,UAT;resources=FT,chrome;max-agents=3;executor=docker;image=gocd-agent`.
+// Keys other than env, resources, min-agents, max-agents, poll-interval, scaling-policy, scaling-step,
+// scaling-factor, scale-up-cooldown, scale-down-cooldown, min-idle-time, registration-timeout, gc-interval,
+// max-lifetime, ephemeral, dry-run and executor are options of the pool's executor. Anything left out of
+// the spec is taken from the defaults for its executor.
+func ParseSpec(spec string, defaults func(executorName string) *Config) (*Config, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	name := strings.TrimSpace(parts[0])
+	if name == "" {
+		return nil, fmt.Errorf("Pool %q has no name", spec)
+	}
+
+	settings := make(map[string]string)
+	if len(parts) == 2 && parts[1] != "" {
+		for _, pair := range strings.Split(parts[1], ";") {
+			keyValue := strings.SplitN(pair, "=", 2)
+			if len(keyValue) != 2 {
+				return nil, fmt.Errorf("Pool %s: expected key=value but found %q", name, pair)
+			}
+			settings[strings.TrimSpace(keyValue[0])] = strings.TrimSpace(keyValue[1])
+		}
+	}
+
+	return FromSettings(name, settings, defaults)
+}
+
+// FromSettings - Creates the config of the named pool from its settings. See ParseSpec for the
+// supported keys, lists are comma separated.
+func FromSettings(name string, settings map[string]string, defaults func(executorName string) *Config) (*Config, error) {
+	executorName, present := settings["executor"]
+	if !present {
+		executorName = defaults("").Executor
+	}
+	if _, err := executor.New(executorName); err != nil {
+		return nil, fmt.Errorf("Pool %s: %s", name, err)
+	}
+	config := defaults(executorName)
+	config.Name = name
+	config.Executor = executorName
+
+	for key, value := range settings {
+		var err error
+		switch key {
+		case "executor":
+			continue
+		case "env":
+			config.Scalar.Env = splitList(value)
+		case "resources":
+			config.Scalar.Resources = splitList(value)
+		case "max-agents":
+			config.Scalar.MaxAgents, err = strconv.Atoi(value)
+		case "min-agents":
+			config.Scalar.MinAgents, err = strconv.Atoi(value)
+		case "poll-interval":
+			config.PollInterval, err = time.ParseDuration(value)
+		case "scale-up-cooldown":
+			config.Scalar.ScaleUpCooldown, err = time.ParseDuration(value)
+		case "scale-down-cooldown":
+			config.Scalar.ScaleDownCooldown, err = time.ParseDuration(value)
+		case "min-idle-time":
+			config.Scalar.MinIdleTime, err = time.ParseDuration(value)
+		case "registration-timeout":
+			config.Scalar.RegistrationTimeout, err = time.ParseDuration(value)
+		case "gc-interval":
+			config.Scalar.GarbageCollectionInterval, err = time.ParseDuration(value)
+		case "max-lifetime":
+			config.Scalar.MaxLifetime, err = time.ParseDuration(value)
+		case "ephemeral":
+			config.Scalar.Ephemeral, err = strconv.ParseBool(value)
+		case "dry-run":
+			config.Scalar.DryRun, err = strconv.ParseBool(value)
+		case "scaling-policy":
+			config.ScalingPolicy = value
+		case "scaling-step":
+			config.ScalingStep, err = strconv.Atoi(value)
+		case "scaling-factor":
+			config.ScalingFactor, err = strconv.ParseFloat(value, 64)
+		default:
+			if !hasOption(executorName, key) {
+				err = fmt.Errorf("unknown setting for executor %s", executorName)
+			}
+			config.ExecutorConfig.Additional[key] = value
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Pool %s: invalid %s=%q - %s", name, key, value, err)
+		}
+	}
+
+	return config, nil
+}
+
+// Settings - Inverse of FromSettings, the settings the pool was created with
+func (c *Config) Settings() map[string]string {
+	settings := make(map[string]string)
+	for key, value := range c.ExecutorConfig.Additional {
+		settings[key] = value
+	}
+	settings["executor"] = c.Executor
+	settings["env"] = strings.Join(c.Scalar.Env, ",")
+	settings["resources"] = strings.Join(c.Scalar.Resources, ",")
+	settings["max-agents"] = strconv.Itoa(c.Scalar.MaxAgents)
+	settings["min-agents"] = strconv.Itoa(c.Scalar.MinAgents)
+	settings["poll-interval"] = c.PollInterval.String()
+	settings["scale-up-cooldown"] = c.Scalar.ScaleUpCooldown.String()
+	settings["scale-down-cooldown"] = c.Scalar.ScaleDownCooldown.String()
+	settings["min-idle-time"] = c.Scalar.MinIdleTime.String()
+	settings["registration-timeout"] = c.Scalar.RegistrationTimeout.String()
+	settings["gc-interval"] = c.Scalar.GarbageCollectionInterval.String()
+	settings["max-lifetime"] = c.Scalar.MaxLifetime.String()
+	settings["ephemeral"] = strconv.FormatBool(c.Scalar.Ephemeral)
+	settings["dry-run"] = strconv.FormatBool(c.Scalar.DryRun)
+	settings["scaling-policy"] = c.ScalingPolicy
+	settings["scaling-step"] = strconv.Itoa(c.ScalingStep)
+	settings["scaling-factor"] = strconv.FormatFloat(c.ScalingFactor, 'g', -1, 64)
+	return settings
+}
+
+// redactSecrets - Settings with the values of the executor's secret options masked, so they're safe to report
+func redactSecrets(executorName string, settings map[string]string) map[string]string {
+	for _, option := range executor.Options(executorName) {
+		if option.Secret && settings[option.Name] != "" {
+			settings[option.Name] = redacted
+		}
+	}
+	return settings
+}
+
+func splitList(value string) []string {
+	elems := []string{}
+	for _, elem := range strings.Split(value, ",") {
+		if elem = strings.TrimSpace(elem); elem != "" {
+			elems = append(elems, elem)
+		}
+	}
+	return elems
+}
+
+func hasOption(executorName string, name string) bool {
+	for _, option := range executor.Options(executorName) {
+		if option.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package pool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ind9/vasuki/executor"
+	"github.com/ind9/vasuki/scalar"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func init() {
+	executor.Register("test", func() executor.Executor {
+		mockExecutor := new(executor.MockExecutor)
+		mockExecutor.On("Init", mock.Anything).Return(nil)
+		return mockExecutor
+	}, executor.Option{Name: "image", Default: "default-image"}, executor.Option{Name: "password", Secret: true})
+}
+
+func testDefaults(executorName string) *Config {
+	if executorName == "" {
+		executorName = "test"
+	}
+	additional := make(map[string]string)
+	for _, option := range executor.Options(executorName) {
+		additional[option.Name] = option.Default
+	}
+	return &Config{
+		PollInterval: 30 * time.Second,
+		Scalar:       scalar.NewConfig([]string{}, []string{}, 1),
+		Executor:     executorName,
+		ExecutorConfig: &executor.Config{
+			ServerHost: "localhost",
+			ServerPort: 8153,
+			Additional: additional,
+		},
+	}
+}
+
+func TestParseSpec(t *testing.T) {
+	config, err := ParseSpec("ft:env=FT,UAT;resources=FT, chrome;min-agents=2;max-agents=5;poll-interval=1m;scaling-policy=proportional;scaling-factor=0.25;scale-up-cooldown=1m;scale-down-cooldown=5m;min-idle-time=10m;registration-timeout=5m;gc-interval=1h;dry-run=true;image=selenium", testDefaults)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "ft", config.Name)
+	assert.Equal(t, "test", config.Executor)
+	assert.Equal(t, []string{"FT", "UAT"}, config.Scalar.Env)
+	assert.Equal(t, []string{"FT", "chrome"}, config.Scalar.Resources)
+	assert.Equal(t, 5, config.Scalar.MaxAgents)
+	assert.Equal(t, 2, config.Scalar.MinAgents)
+	assert.Equal(t, time.Minute, config.PollInterval)
+	assert.Equal(t, "proportional", config.ScalingPolicy)
+	assert.Equal(t, 0.25, config.ScalingFactor)
+	assert.Equal(t, time.Minute, config.Scalar.ScaleUpCooldown)
+	assert.Equal(t, 5*time.Minute, config.Scalar.ScaleDownCooldown)
+	assert.Equal(t, 10*time.Minute, config.Scalar.MinIdleTime)
+	assert.Equal(t, 5*time.Minute, config.Scalar.RegistrationTimeout)
+	assert.Equal(t, time.Hour, config.Scalar.GarbageCollectionInterval)
+	assert.True(t, config.Scalar.DryRun)
+	assert.Equal(t, "selenium", config.ExecutorConfig.Additional["image"])
+	assert.Equal(t, "localhost", config.ExecutorConfig.ServerHost)
+}
+
+func TestParseSpecFallsBackToDefaults(t *testing.T) {
+	config, err := ParseSpec("plain", testDefaults)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "plain", config.Name)
+	assert.Equal(t, 1, config.Scalar.MaxAgents)
+	assert.Equal(t, 30*time.Second, config.PollInterval)
+	assert.Equal(t, "default-image", config.ExecutorConfig.Additional["image"])
+}
+
+func TestParseSpecFailsForInvalidSpecs(t *testing.T) {
+	invalidSpecs := []string{
+		":env=FT",
+		"ft:env",
+		"ft:max-agents=many",
+		"ft:min-agents=few",
+		"ft:scaling-step=big",
+		"ft:scaling-factor=half",
+		"ft:min-idle-time=long",
+		"ft:poll-interval=often",
+		"ft:unknown=value",
+		"ft:executor=unknown",
+	}
+	for _, spec := range invalidSpecs {
+		_, err := ParseSpec(spec, testDefaults)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestSettingsRoundTripThroughFromSettings(t *testing.T) {
+	config, err := ParseSpec("ft:env=FT,UAT;resources=FT;max-agents=5;min-agents=1;scaling-policy=fixed-step;scaling-step=2;min-idle-time=10m;image=selenium", testDefaults)
+	assert.NoError(t, err)
+
+	settings := config.Settings()
+	assert.Equal(t, "FT,UAT", settings["env"])
+	assert.Equal(t, "selenium", settings["image"])
+	assert.Equal(t, "10m0s", settings["min-idle-time"])
+
+	again, err := FromSettings("ft", settings, testDefaults)
+	assert.NoError(t, err)
+	assert.Equal(t, config, again)
+}
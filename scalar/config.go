@@ -1,24 +1,90 @@
 package scalar
 
-import "github.com/ind9/vasuki/utils/sets"
+import (
+	"fmt"
+	"time"
+
+	"github.com/ind9/vasuki/utils/sets"
+)
 
 // Config - Holds scalar configurations
 type Config struct {
 	Env       []string
 	Resources []string
 	MaxAgents int
+	MinAgents int // Warm pool - # of idle agents that are always kept ready on top of the demand
+	Policy    ScalingPolicy
+	// Minimum time between two scale ups
+	ScaleUpCooldown time.Duration
+	// Minimum time since the last scale up or down before scaling down
+	ScaleDownCooldown time.Duration
+	// Minimum time an agent has to be idle before it can be scaled down
+	MinIdleTime time.Duration
+	// Time an agent gets to register with the GoCD Server before it's replaced, 0 disables it
+	RegistrationTimeout time.Duration
+	// How often the agents left behind by the executor are cleaned up, 0 disables it
+	GarbageCollectionInterval time.Duration
+	// Age after which an idle agent is replaced, 0 disables it
+	MaxLifetime time.Duration
+	// Agents run a single job, after which they're removed instead of being reused
+	Ephemeral bool
+	// Only log the scaling decisions, without changing anything on the GoCD Server or the executor
+	DryRun bool
+	// Configs of the profiles defined before this one in the same pool, the jobs they match are left to them
+	Preceding []*Config
+	// Max agents of the pool this profile belongs to, shared with its other profiles
+	Shared *SharedMaxAgents
 }
 
-// NewConfig - Creates a new scalar.Config instance
+// NewConfig - Creates a new scalar.Config instance that scales with the HalfStep policy
 func NewConfig(env []string, resources []string, maxAgents int) *Config {
 	return &Config{
 		Env:       env,
 		Resources: resources,
 		MaxAgents: maxAgents,
+		Policy:    &HalfStep{},
+	}
+}
+
+// Validate - Checks if the config can be scaled with
+func (c *Config) Validate() error {
+	if c.MaxAgents < 1 {
+		return fmt.Errorf("max agents must be at least 1, found %d", c.MaxAgents)
+	}
+	if c.MinAgents < 0 || c.MinAgents > c.MaxAgents {
+		return fmt.Errorf("min agents must be between 0 and max agents (%d), found %d", c.MaxAgents, c.MinAgents)
+	}
+	if c.ScaleUpCooldown < 0 || c.ScaleDownCooldown < 0 || c.MinIdleTime < 0 {
+		return fmt.Errorf("cooldowns and min idle time must not be negative")
+	}
+	if c.RegistrationTimeout < 0 {
+		return fmt.Errorf("registration timeout must not be negative, found %s", c.RegistrationTimeout)
 	}
+	if c.GarbageCollectionInterval < 0 {
+		return fmt.Errorf("garbage collection interval must not be negative, found %s", c.GarbageCollectionInterval)
+	}
+	if c.MaxLifetime < 0 {
+		return fmt.Errorf("max lifetime must not be negative, found %s", c.MaxLifetime)
+	}
+	return nil
+}
+
+// wanted - # of agents we'd like to have for the demand, including the warm pool
+func (c *Config) wanted(demand int) int {
+	return demand + c.MinAgents
 }
 
+// matchJob - If the job is demand of this config, i.e. it can run on our agents and none of the preceding profiles can take it
 func (c *Config) matchJob(jobEnv string, jobResources []string) bool {
+	for _, preceding := range c.Preceding {
+		if preceding.canRun(jobEnv, jobResources) {
+			return false
+		}
+	}
+	return c.canRun(jobEnv, jobResources)
+}
+
+func (c *Config) canRun(jobEnv string, jobResources []string) bool {
 	vasukiEnv := sets.FromSlice(c.Env)
 	vasukiResource := sets.FromSlice(c.Resources)
 
@@ -2,6 +2,7 @@ package scalar
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -37,6 +38,18 @@ func TestConfigMatchWhenOnlyNoEnvironment(t *testing.T) {
 	assert.False(t, config.matchJob("", []string{"docker"}))
 }
 
+func TestConfigMatchLeavesJobsToThePrecedingProfiles(t *testing.T) {
+	selenium := &Config{Env: []string{"FT"}, Resources: []string{"FT", "chrome"}}
+	jdk11 := &Config{Env: []string{"FT"}, Resources: []string{"FT", "jdk11"}, Preceding: []*Config{selenium}}
+
+	assert.True(t, selenium.matchJob("FT", []string{"chrome"}))
+	assert.False(t, jdk11.matchJob("FT", []string{"chrome"}))
+	assert.True(t, jdk11.matchJob("FT", []string{"jdk11"}))
+	// Both of them can run it, it's left to the first one
+	assert.True(t, selenium.matchJob("FT", []string{"FT"}))
+	assert.False(t, jdk11.matchJob("FT", []string{"FT"}))
+}
+
 func TestConfigAgentMatch(t *testing.T) {
 	config := Config{
 		Env:       []string{"FT", "Staging"},
@@ -88,3 +101,23 @@ func TestConfigAgentMatchWhenOnlyEnvironment(t *testing.T) {
 	agentResources = []string{"Staging"}
 	assert.False(t, config.matchAgent(agentEnv, agentResources))
 }
+
+func TestConfigValidate(t *testing.T) {
+	config := NewConfig([]string{}, []string{}, 2)
+	assert.NoError(t, config.Validate())
+
+	config.MinAgents = 2
+	assert.NoError(t, config.Validate())
+
+	config.MinAgents = 3
+	assert.Error(t, config.Validate())
+
+	config.MinAgents = -1
+	assert.Error(t, config.Validate())
+
+	assert.Error(t, NewConfig([]string{}, []string{}, 0).Validate())
+
+	config = NewConfig([]string{}, []string{}, 2)
+	config.MaxLifetime = -time.Hour
+	assert.Error(t, config.Validate())
+}
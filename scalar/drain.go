@@ -0,0 +1,125 @@
+package scalar
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/ind9/vasuki/utils/logging"
+	"github.com/ind9/vasuki/utils/sets"
+)
+
+// drainPollInterval - How often Drain checks if the disabled agents are done building, replaced in tests
+var drainPollInterval = 5 * time.Second
+
+// Drain - Removes every agent managed by the executor of the Scalar without dropping the jobs they're
+// building. The agents are disabled on the GoCD Server so they don't get new work, and each of them is
+// deleted and killed once it has no work, checked no sooner than a poll after it was disabled like in
+// finishScaleDown. Agents that are still building after the timeout are enabled back and left running,
+// so their jobs can finish. So are the agents that couldn't be deleted, and the ones that couldn't be
+// disabled are never waited on. Agents that are gone from the GoCD Server meanwhile are only killed.
+func Drain(s Scalar, timeout time.Duration) error {
+	config := s.config()
+	managedAgents, err := s.executor().ManagedAgents()
+	if err != nil {
+		return err
+	}
+	if len(managedAgents) == 0 {
+		return nil
+	}
+	if config.DryRun {
+		logging.Log.Infof("[dry run] Would drain the agents %v", managedAgents)
+		return nil
+	}
+	logging.Log.Infof("Draining %d agents with Env=%v, Resources=%v", len(managedAgents), config.Env, config.Resources)
+
+	var resultErr *multierror.Error
+	agents, err := s.client().GetAllAgents()
+	if err != nil {
+		return err
+	}
+	registered := (&Snapshot{Agents: agents}).registered()
+	var unregistered []string
+	draining := sets.Empty()
+	for _, agentID := range managedAgents {
+		if !registered.Contains(agentID) {
+			unregistered = append(unregistered, agentID)
+			continue
+		}
+		logging.Log.Infof("Disabling the agent %s on Go Server", agentID)
+		if err := s.client().DisableAgent(agentID); err != nil {
+			// It would still take jobs, it's left running
+			resultErr = updateErrors(resultErr, fmt.Errorf("agent %s couldn't be disabled and is left running - %s", agentID, err))
+			continue
+		}
+		draining.Add(agentID)
+	}
+
+	drained := unregistered
+	deadline := now().Add(timeout)
+	for draining.Size() > 0 && now().Before(deadline) {
+		// GoCD can still assign a job to an agent it hasn't noticed was disabled, so it's given a poll
+		logging.Log.Infof("Waiting for %d agents to finish building", draining.Size())
+		time.Sleep(drainPollInterval)
+		agents, err := s.client().GetAllAgents()
+		if err != nil {
+			logging.Log.Warningf("Couldn't get the agents to drain from the Go Server: %s", err)
+			continue
+		}
+		registered := (&Snapshot{Agents: agents}).registered()
+		for _, agentID := range sortedValues(draining) {
+			if !registered.Contains(agentID) {
+				logging.Log.Infof("Agent %s is gone from the Go Server, it's only killed", agentID)
+				drained = append(drained, agentID)
+				draining.Remove(agentID)
+				continue
+			}
+			busy, err := hasWork(s, agentID)
+			if err == errAgentGone {
+				logging.Log.Infof("Agent %s is gone from the Go Server, it's only killed", agentID)
+				drained = append(drained, agentID)
+				draining.Remove(agentID)
+				continue
+			}
+			if err != nil {
+				logging.Log.Warningf("Couldn't check if the agent %s is done building: %s", agentID, err)
+				continue
+			}
+			if busy {
+				continue
+			}
+			logging.Log.Infof("Deleting the drained agent %s on Go Server", agentID)
+			draining.Remove(agentID)
+			if err := s.client().DeleteAgent(agentID); err != nil {
+				// Killing it would leave it on the server as lost contact, so it's enabled back and left running
+				resultErr = updateErrors(resultErr, fmt.Errorf("agent %s couldn't be deleted and is left running - %s", agentID, err))
+				resultErr = updateErrors(resultErr, s.client().EnableAgent(agentID))
+				continue
+			}
+			drained = append(drained, agentID)
+		}
+	}
+
+	stillBuilding := sortedValues(draining)
+	for _, agentID := range stillBuilding {
+		logging.Log.Warningf("Agent %s is still building after %s, enabling it back", agentID, timeout)
+		resultErr = updateErrors(resultErr, s.client().EnableAgent(agentID))
+	}
+	if len(stillBuilding) > 0 {
+		resultErr = updateErrors(resultErr, fmt.Errorf("agents %v were still building after %s and are left running", stillBuilding, timeout))
+	}
+
+	if len(drained) > 0 {
+		result, err := s.executor().ScaleDown(drained)
+		resultErr = updateErrors(resultErr, executorErr(result, err, "kill"))
+	}
+	return resultErr.ErrorOrNil()
+}
+
+// sortedValues - Elements of the set in a stable order
+func sortedValues(set sets.Set) []string {
+	values := set.Values()
+	sort.Strings(values)
+	return values
+}
@@ -0,0 +1,113 @@
+package scalar
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ashwanthkumar/go-gocd"
+	"github.com/ind9/vasuki/executor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func init() {
+	drainPollInterval = time.Millisecond
+}
+
+func TestDrainWaitsForBuildingAgentsBeforeRemovingThem(t *testing.T) {
+	scalar, client, mockExecutor := newTestScalar(nil)
+	client.On("GetAllAgents").Return([]*gocd.Agent{{UUID: "agent-1"}, {UUID: "agent-2"}}, nil)
+	client.On("GetAgent", "agent-1").Return(&gocd.Agent{BuildState: "Building"}, nil).Once()
+	client.On("GetAgent", "agent-1").Return(&gocd.Agent{BuildState: "Idle"}, nil)
+	client.On("GetAgent", "agent-2").Return(&gocd.Agent{BuildState: "Idle"}, nil)
+	client.On("AgentRunJobHistory", mock.Anything, 0).Return([]*gocd.JobHistory{{State: "Completed"}}, nil)
+	client.On("DisableAgent", "agent-1").Return(nil)
+	client.On("DisableAgent", "agent-2").Return(nil)
+	client.On("DeleteAgent", "agent-1").Return(nil)
+	client.On("DeleteAgent", "agent-2").Return(nil)
+	mockExecutor.On("ManagedAgents").Return([]string{"agent-1", "agent-2", "never-registered"}, nil)
+	mockExecutor.On("ScaleDown", []string{"never-registered", "agent-2", "agent-1"}).Return(executor.Result{Succeeded: []string{"never-registered", "agent-2", "agent-1"}}, nil)
+
+	err := Drain(scalar, time.Minute)
+	assert.NoError(t, err)
+	client.AssertExpectations(t)
+	mockExecutor.AssertExpectations(t)
+}
+
+func TestDrainDoesNotDeleteAgentsThatWereAssignedAJob(t *testing.T) {
+	scalar, client, mockExecutor := newTestScalar(nil)
+	client.On("GetAllAgents").Return([]*gocd.Agent{{UUID: "agent-1"}}, nil)
+	// The agents API still reports the agent as idle, but the job history knows better
+	client.On("GetAgent", "agent-1").Return(&gocd.Agent{BuildState: "Idle"}, nil)
+	client.On("AgentRunJobHistory", "agent-1", 0).Return([]*gocd.JobHistory{{State: "Assigned"}}, nil)
+	client.On("DisableAgent", "agent-1").Return(nil)
+	client.On("EnableAgent", "agent-1").Return(nil)
+	mockExecutor.On("ManagedAgents").Return([]string{"agent-1"}, nil)
+
+	err := Drain(scalar, 5*time.Millisecond)
+	assert.Error(t, err)
+	client.AssertExpectations(t)
+	client.AssertNotCalled(t, "DeleteAgent", "agent-1")
+	mockExecutor.AssertNotCalled(t, "ScaleDown", []string{"agent-1"})
+}
+
+func TestDrainOnlyKillsAgentsThatAreGoneFromTheServer(t *testing.T) {
+	scalar, client, mockExecutor := newTestScalar(nil)
+	client.On("GetAllAgents").Return([]*gocd.Agent{{UUID: "agent-1"}}, nil).Once()
+	client.On("GetAllAgents").Return([]*gocd.Agent{}, nil)
+	client.On("DisableAgent", "agent-1").Return(nil)
+	mockExecutor.On("ManagedAgents").Return([]string{"agent-1"}, nil)
+	mockExecutor.On("ScaleDown", []string{"agent-1"}).Return(executor.Result{Succeeded: []string{"agent-1"}}, nil)
+
+	err := Drain(scalar, time.Minute)
+	assert.NoError(t, err)
+	client.AssertNotCalled(t, "DeleteAgent", "agent-1")
+	client.AssertNotCalled(t, "EnableAgent", "agent-1")
+	mockExecutor.AssertExpectations(t)
+}
+
+func TestDrainEnablesAgentsStillBuildingAfterTheTimeout(t *testing.T) {
+	scalar, client, mockExecutor := newTestScalar(nil)
+	client.On("GetAllAgents").Return([]*gocd.Agent{{UUID: "agent-1"}}, nil)
+	client.On("GetAgent", "agent-1").Return(&gocd.Agent{BuildState: "Building"}, nil)
+	client.On("DisableAgent", "agent-1").Return(nil)
+	client.On("EnableAgent", "agent-1").Return(nil)
+	mockExecutor.On("ManagedAgents").Return([]string{"agent-1"}, nil)
+
+	err := Drain(scalar, 5*time.Millisecond)
+	assert.Error(t, err)
+	client.AssertExpectations(t)
+	client.AssertNotCalled(t, "DeleteAgent", "agent-1")
+	mockExecutor.AssertNotCalled(t, "ScaleDown", []string{"agent-1"})
+}
+
+func TestDrainInDryRunOnlyLogs(t *testing.T) {
+	scalar, client, mockExecutor := newTestScalar(nil)
+	mockExecutor.On("ManagedAgents").Return([]string{"agent-1"}, nil)
+	scalar.config().DryRun = true
+
+	assert.NoError(t, Drain(scalar, time.Minute))
+	client.AssertNotCalled(t, "DisableAgent", "agent-1")
+	mockExecutor.AssertNotCalled(t, "ScaleDown", []string{"agent-1"})
+}
+
+func TestDrainLeavesRunningTheAgentsThatCouldNotBeDisabledOrDeleted(t *testing.T) {
+	scalar, client, mockExecutor := newTestScalar(nil)
+	client.On("GetAllAgents").Return([]*gocd.Agent{{UUID: "agent-1"}, {UUID: "agent-2"}}, nil)
+	client.On("DisableAgent", "agent-1").Return(errors.New("disable failed"))
+	client.On("DisableAgent", "agent-2").Return(nil)
+	client.On("GetAgent", "agent-2").Return(&gocd.Agent{BuildState: "Idle"}, nil)
+	client.On("AgentRunJobHistory", "agent-2", 0).Return([]*gocd.JobHistory{}, nil)
+	client.On("DeleteAgent", "agent-2").Return(errors.New("delete failed"))
+	client.On("EnableAgent", "agent-2").Return(nil)
+	mockExecutor.On("ManagedAgents").Return([]string{"agent-1", "agent-2"}, nil)
+
+	err := Drain(scalar, time.Minute)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "agent agent-1 couldn't be disabled")
+	assert.Contains(t, err.Error(), "agent agent-2 couldn't be deleted")
+	client.AssertNotCalled(t, "GetAgent", "agent-1")
+	client.AssertExpectations(t)
+	mockExecutor.AssertNotCalled(t, "ScaleDown", mock.Anything)
+}
@@ -0,0 +1,82 @@
+package scalar
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/ind9/vasuki/utils/logging"
+	"github.com/ind9/vasuki/utils/sets"
+)
+
+// retireUsedAgents - In ephemeral mode every agent runs a single job. An agent is disabled as soon as it's
+// seen building, GoCD lets it finish the job but doesn't assign it another one. It's then deleted and killed
+// by finishScaleDown once it's done, like the agents that are scaled down.
+func retireUsedAgents(s Scalar, snapshot *Snapshot, at time.Time) error {
+	config := s.config()
+	history := s.history()
+	used, err := usedAgents(s, snapshot)
+	if len(used) == 0 {
+		return err
+	}
+	var resultErr *multierror.Error
+	resultErr = updateErrors(resultErr, err)
+	if config.DryRun {
+		logging.Log.Infof("[dry run] Agents %v ran a job, would disable, delete and kill them once they're done", used)
+		history.status.Plan.Retire = used
+		return resultErr.ErrorOrNil()
+	}
+
+	disabled := 0
+	for _, agentID := range used {
+		logging.Log.Infof("Agent %s ran a job, disabling it so it doesn't get another one", agentID)
+		err := s.client().DisableAgent(agentID)
+		resultErr = updateErrors(resultErr, err)
+		if err == nil {
+			history.pendingScaleDown[agentID] = at
+			history.retired.Add(agentID)
+			disabled++
+		}
+	}
+	if disabled > 0 {
+		history.recordAction(fmt.Sprintf("disabled %d agents that ran their job", disabled), at)
+	}
+	return resultErr.ErrorOrNil()
+}
+
+// usedAgents - Agents launched by the executor that are building, and the idle ones whose job history isn't
+// empty, in case the whole job ran between two ticks. Agents registered by hand are never retired, and the
+// ones that are already being removed are left out.
+func usedAgents(s Scalar, snapshot *Snapshot) ([]string, error) {
+	config := s.config()
+	history := s.history()
+	managedAgents, err := s.executor().ManagedAgents()
+	if err != nil {
+		return nil, err
+	}
+	managed := sets.FromSlice(managedAgents)
+	var resultErr *multierror.Error
+	var used []string
+	for _, agent := range snapshot.Agents {
+		if _, pending := history.pendingScaleDown[agent.UUID]; pending || !managed.Contains(agent.UUID) ||
+			!config.matchAgent(agent.Env, agent.Resources) {
+			continue
+		}
+		if agent.BuildState == "Building" {
+			used = append(used, agent.UUID)
+			continue
+		}
+		if agent.BuildState != "Idle" && agent.BuildState != "Unknown" {
+			continue
+		}
+		jobs, err := s.client().AgentRunJobHistory(agent.UUID, 0)
+		if err != nil {
+			resultErr = updateErrors(resultErr, err)
+			continue
+		}
+		if len(jobs) > 0 {
+			used = append(used, agent.UUID)
+		}
+	}
+	return used, resultErr.ErrorOrNil()
+}
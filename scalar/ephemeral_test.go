@@ -0,0 +1,143 @@
+package scalar
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ashwanthkumar/go-gocd"
+	gocdmocks "github.com/ashwanthkumar/go-gocd/mocks"
+	"github.com/ind9/vasuki/executor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newEphemeralScalar(managedAgents ...string) (*SimpleScalar, *gocdmocks.Client, *executor.MockExecutor) {
+	scalar, client, mockExecutor := newTestScalar(func(config *Config) {
+		config.Ephemeral = true
+	})
+	mockExecutor.On("ManagedAgents").Return(managedAgents, nil)
+	return scalar, client, mockExecutor
+}
+
+func ephemeralAgent(uuid string, state string) *gocd.Agent {
+	return &gocd.Agent{UUID: uuid, Env: TestEnv, Resources: TestResources, AgentState: state, BuildState: state}
+}
+
+func TestRetireUsedAgentsDisablesTheAgentsAsSoonAsTheyAreBuilding(t *testing.T) {
+	scalar, client, mockExecutor := newEphemeralScalar("used-agent")
+	client.On("DisableAgent", "used-agent").Return(nil)
+	at := time.Now()
+
+	err := retireUsedAgents(scalar, &Snapshot{Agents: []*gocd.Agent{ephemeralAgent("used-agent", "Building")}}, at)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Time{"used-agent": at}, scalar.history().pendingScaleDown)
+	assert.Equal(t, "disabled 1 agents that ran their job", scalar.history().status.LastAction)
+	client.AssertNotCalled(t, "DeleteAgent", mock.Anything)
+	mockExecutor.AssertNotCalled(t, "ScaleDown", mock.Anything)
+
+	// Already being removed, it isn't disabled again
+	err = retireUsedAgents(scalar, &Snapshot{Agents: []*gocd.Agent{ephemeralAgent("used-agent", "Building")}}, at)
+	assert.NoError(t, err)
+	client.AssertNumberOfCalls(t, "DisableAgent", 1)
+}
+
+func TestRetireUsedAgentsLeavesTheAgentsRegisteredByHandAlone(t *testing.T) {
+	scalar, client, _ := newEphemeralScalar("used-agent")
+
+	err := retireUsedAgents(scalar, &Snapshot{Agents: []*gocd.Agent{ephemeralAgent("static-agent", "Building")}}, time.Now())
+	assert.NoError(t, err)
+	assert.Empty(t, scalar.history().pendingScaleDown)
+	client.AssertNotCalled(t, "DisableAgent", mock.Anything)
+}
+
+func TestRetireUsedAgentsFindsJobsThatRanBetweenTwoTicks(t *testing.T) {
+	scalar, client, mockExecutor := newEphemeralScalar("fresh-agent", "used-agent")
+	client.On("AgentRunJobHistory", "fresh-agent", 0).Return([]*gocd.JobHistory{}, nil)
+	client.On("AgentRunJobHistory", "used-agent", 0).Return([]*gocd.JobHistory{{State: "Completed"}}, nil)
+	client.On("DisableAgent", "used-agent").Return(nil)
+	at := time.Now()
+
+	snapshot := &Snapshot{Agents: []*gocd.Agent{ephemeralAgent("fresh-agent", "Idle"), ephemeralAgent("used-agent", "Idle")}}
+	err := retireUsedAgents(scalar, snapshot, at)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Time{"used-agent": at}, scalar.history().pendingScaleDown)
+	client.AssertNotCalled(t, "DisableAgent", "fresh-agent")
+	mockExecutor.AssertNotCalled(t, "ScaleDown", mock.Anything)
+}
+
+func TestRetiredAgentsAreRemovedOnceTheirJobIsDone(t *testing.T) {
+	scalar, client, mockExecutor := newEphemeralScalar("used-agent")
+	client.On("DisableAgent", "used-agent").Return(nil)
+	client.On("GetAgent", "used-agent").Return(&gocd.Agent{BuildState: "Building"}, nil).Once()
+	client.On("GetAgent", "used-agent").Return(&gocd.Agent{BuildState: "Idle"}, nil).Once()
+	client.On("AgentRunJobHistory", "used-agent", 0).Return([]*gocd.JobHistory{{State: "Completed"}}, nil)
+	client.On("DeleteAgent", "used-agent").Return(nil)
+	mockExecutor.On("ScaleDown", []string{"used-agent"}).Return(executor.Result{Succeeded: []string{"used-agent"}}, nil)
+
+	err := retireUsedAgents(scalar, &Snapshot{Agents: []*gocd.Agent{ephemeralAgent("used-agent", "Building")}}, time.Now())
+	assert.NoError(t, err)
+
+	// Still building on the next tick, it's kept disabled instead of being enabled back
+	err = finishScaleDown(scalar)
+	assert.NoError(t, err)
+	assert.Contains(t, scalar.history().pendingScaleDown, "used-agent")
+	client.AssertNotCalled(t, "EnableAgent", "used-agent")
+	client.AssertNotCalled(t, "DeleteAgent", "used-agent")
+	mockExecutor.AssertNotCalled(t, "ScaleDown", mock.Anything)
+
+	err = finishScaleDown(scalar)
+	assert.NoError(t, err)
+	assert.Empty(t, scalar.history().pendingScaleDown)
+	assert.Equal(t, 1, scalar.history().status.ScaledDown)
+	client.AssertExpectations(t)
+	mockExecutor.AssertExpectations(t)
+}
+
+func TestEphemeralScaleUpStartsAnAgentForEveryQueuedJob(t *testing.T) {
+	scalar, _, _ := newEphemeralScalar()
+	scalar.config().Policy = &HalfStep{}
+
+	instances, err := scalar.ComputeScaleUp(TestMaxAgents, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, TestMaxAgents, instances)
+
+	instances, err = scalar.ComputeScaleUp(TestMaxAgents+5, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, TestMaxAgents, instances)
+}
+
+func TestEphemeralDemandLeavesOutTheBuildingAgents(t *testing.T) {
+	scalar, _, _ := newEphemeralScalar()
+	snapshot := &Snapshot{Agents: []*gocd.Agent{ephemeralAgent("used-agent", "Building")}}
+
+	demand, err := scalar.Demand(snapshot)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, demand)
+}
+
+func TestDryRunPlansTheRetirementOfUsedAgents(t *testing.T) {
+	scalar, client, mockExecutor := newEphemeralScalar("used-agent")
+	scalar.config().DryRun = true
+	scalar.history().status.Plan = &Plan{}
+
+	err := retireUsedAgents(scalar, &Snapshot{Agents: []*gocd.Agent{ephemeralAgent("used-agent", "Building")}}, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"used-agent"}, scalar.history().status.Plan.Retire)
+	assert.Empty(t, scalar.history().pendingScaleDown)
+	client.AssertNotCalled(t, "DisableAgent", mock.Anything)
+	mockExecutor.AssertNotCalled(t, "ScaleDown", mock.Anything)
+}
+
+func TestCancelScaleDownLeavesTheRetiredAgentsDisabled(t *testing.T) {
+	scalar, client, _ := newEphemeralScalar("used-agent", "idle-agent")
+	client.On("DisableAgent", "used-agent").Return(nil)
+	client.On("EnableAgent", "idle-agent").Return(nil)
+	scalar.history().pendingScaleDown["idle-agent"] = time.Now()
+	assert.NoError(t, retireUsedAgents(scalar, &Snapshot{Agents: []*gocd.Agent{ephemeralAgent("used-agent", "Building")}}, time.Now()))
+
+	assert.NoError(t, CancelScaleDown(scalar))
+	client.AssertExpectations(t)
+	client.AssertNotCalled(t, "EnableAgent", "used-agent")
+	assert.Contains(t, scalar.history().pendingScaleDown, "used-agent")
+	assert.NotContains(t, scalar.history().pendingScaleDown, "idle-agent")
+}
@@ -0,0 +1,59 @@
+package scalar
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/ind9/vasuki/executor"
+	"github.com/ind9/vasuki/utils/logging"
+)
+
+// orphanGracePeriod - Time a launched agent gets to show up on the GoCD Server before it's taken for an
+// orphan, unless the RegistrationTimeout is longer
+const orphanGracePeriod = 10 * time.Minute
+
+// collectGarbage - Has the executor remove the agents it left behind, when it's an executor.GarbageCollector,
+// and deletes the agents of the GoCD Server that belonged to them. Those have lost contact with the server
+// and would be listed on it forever otherwise.
+func collectGarbage(s Scalar, snapshot *Snapshot, at time.Time) error {
+	config := s.config()
+	history := s.history()
+	collector, ok := s.executor().(executor.GarbageCollector)
+	if !ok {
+		return nil
+	}
+	history.lastGarbageCollection = at
+	if config.DryRun {
+		logging.Log.Debugf("[dry run] Not collecting the agents left behind by the executor")
+		return nil
+	}
+
+	gracePeriod := orphanGracePeriod
+	if config.RegistrationTimeout > gracePeriod {
+		// Agents that never registered are replaced by replaceUnregisteredAgents until then
+		gracePeriod = config.RegistrationTimeout
+	}
+	registered := snapshot.registered()
+	removed, err := collector.CollectGarbage(registered.Values(), at.Add(-gracePeriod))
+	var resultErr *multierror.Error
+	resultErr = updateErrors(resultErr, err)
+	for _, agentID := range removed {
+		// Nothing is left to scale down once the agent is gone
+		history.forgetScaleDown(agentID)
+		if !registered.Contains(agentID) {
+			continue
+		}
+		logging.Log.Infof("Deleting the agent %s on Go Server as it was left behind by the executor", agentID)
+		err := s.client().DisableAgent(agentID)
+		if err == nil {
+			err = s.client().DeleteAgent(agentID)
+		}
+		resultErr = updateErrors(resultErr, err)
+	}
+	if len(removed) > 0 {
+		history.status.GarbageCollected += len(removed)
+		history.recordAction(fmt.Sprintf("removed %d agents left behind", len(removed)), at)
+	}
+	return resultErr.ErrorOrNil()
+}
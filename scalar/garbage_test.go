@@ -0,0 +1,82 @@
+package scalar
+
+import (
+	"testing"
+	"time"
+
+	gocdmocks "github.com/ashwanthkumar/go-gocd/mocks"
+	"github.com/ind9/vasuki/executor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// collectingExecutor - Executor that can also collect garbage
+type collectingExecutor struct {
+	*executor.MockExecutor
+	*executor.MockGarbageCollector
+}
+
+// newGarbageScalar - Scalar whose executor collects garbage through the given collector, if any
+func newGarbageScalar(collector *executor.MockGarbageCollector) (*SimpleScalar, *gocdmocks.Client) {
+	scalar, client, mockExecutor := newTestScalar(func(config *Config) {
+		config.GarbageCollectionInterval = time.Minute
+	})
+	if collector != nil {
+		scalar._executor = &collectingExecutor{mockExecutor, collector}
+	}
+	return scalar, client
+}
+
+func TestCollectGarbageDeletesTheAgentsOfRemovedContainers(t *testing.T) {
+	at := time.Now()
+	collector := new(executor.MockGarbageCollector)
+	collector.On("CollectGarbage", mock.Anything, at.Add(-orphanGracePeriod)).Return([]string{"exited-agent", "orphan-agent"}, nil)
+	scalar, client := newGarbageScalar(collector)
+	h, snapshot := scalar.history(), snapshotOf("exited-agent", "running-agent")
+	h.pendingScaleDown["exited-agent"] = at.Add(-time.Minute)
+	client.On("DisableAgent", "exited-agent").Return(nil)
+	client.On("DeleteAgent", "exited-agent").Return(nil)
+
+	err := collectGarbage(scalar, snapshot, at)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, h.status.GarbageCollected)
+	assert.Equal(t, at, h.lastGarbageCollection)
+	assert.Empty(t, h.pendingScaleDown)
+	assert.ElementsMatch(t, []string{"exited-agent", "running-agent"}, collector.Calls[0].Arguments.Get(0))
+	client.AssertExpectations(t)
+	client.AssertNotCalled(t, "DeleteAgent", "orphan-agent")
+}
+
+func TestCollectGarbageWaitsForTheRegistrationTimeout(t *testing.T) {
+	at := time.Now()
+	collector := new(executor.MockGarbageCollector)
+	collector.On("CollectGarbage", mock.Anything, at.Add(-time.Hour)).Return([]string{}, nil)
+	scalar, _ := newGarbageScalar(collector)
+	h, snapshot := scalar.history(), snapshotOf("exited-agent", "running-agent")
+	scalar.config().RegistrationTimeout = time.Hour
+
+	err := collectGarbage(scalar, snapshot, at)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, h.status.GarbageCollected)
+	collector.AssertExpectations(t)
+}
+
+func TestCollectGarbageIsSkippedInDryRun(t *testing.T) {
+	collector := new(executor.MockGarbageCollector)
+	scalar, _ := newGarbageScalar(collector)
+	snapshot := snapshotOf("exited-agent", "running-agent")
+	scalar.config().DryRun = true
+
+	err := collectGarbage(scalar, snapshot, time.Now())
+	assert.NoError(t, err)
+	collector.AssertNotCalled(t, "CollectGarbage", mock.Anything, mock.Anything)
+}
+
+func TestCollectGarbageIgnoresExecutorsWithoutGarbage(t *testing.T) {
+	scalar, _ := newGarbageScalar(nil)
+	h, snapshot := scalar.history(), snapshotOf("exited-agent", "running-agent")
+
+	err := collectGarbage(scalar, snapshot, time.Now())
+	assert.NoError(t, err)
+	assert.True(t, h.lastGarbageCollection.IsZero())
+}
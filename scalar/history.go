@@ -0,0 +1,171 @@
+package scalar
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ind9/vasuki/executor"
+	"github.com/ind9/vasuki/utils/sets"
+)
+
+// now - Clock of the scalar, replaced in tests
+var now = time.Now
+
+// history - Scaling activity of a Scalar that's carried across ticks
+type history struct {
+	lastScaleUp           time.Time
+	lastScaleDown         time.Time
+	lastGarbageCollection time.Time
+	idleSince             map[string]time.Time // When each agent was first seen idle
+	registered            sets.Set             // Launched agents that have shown up on the GoCD Server
+	// Agents that were disabled to be scaled down, along with when that happened
+	pendingScaleDown map[string]time.Time
+	// Pending agents that ran their job in ephemeral mode, they're never enabled back
+	retired sets.Set
+	// Agents older than the max lifetime whose replacement was started, but that couldn't be disabled yet
+	replaced sets.Set
+	// # of agents that had to be replaced because they never registered
+	registrationFailures int
+	status               Status
+}
+
+// Status - What a Scalar found and did as of its last Execute
+type Status struct {
+	Demand   int `json:"demand"` // Excludes the warm pool
+	Queued   int `json:"queued"`
+	Building int `json:"building"`
+	Supply   int `json:"supply"`
+	// Only counted when there's excess supply or agents have to be idle for a while before they're removed
+	Idle         int       `json:"idle"`
+	LastAction   string    `json:"last-action"`
+	LastActionAt time.Time `json:"last-action-at"`
+	// Totals since the Scalar was created
+	ScaledUp             int `json:"scaled-up"`
+	ScaledDown           int `json:"scaled-down"`
+	ScaleUpFailures      int `json:"scale-up-failures"`
+	ScaleDownFailures    int `json:"scale-down-failures"`
+	RegistrationFailures int `json:"registration-failures"`
+	GarbageCollected     int `json:"garbage-collected"` // Agents left behind by the executor that were removed
+	Recycled             int `json:"recycled"`          // Agents that were replaced for being older than the max lifetime
+	// What the last Execute would've done, only set in dry run mode
+	Plan *Plan `json:"dry-run-plan,omitempty"`
+}
+
+// Plan - Actions a Scalar would've taken, but didn't because it's in dry run mode
+type Plan struct {
+	ScaleUp   int      `json:"scale-up"`   // # of agents that would be started
+	ScaleDown []string `json:"scale-down"` // Agents that would be disabled, deleted and killed
+	Replace   []string `json:"replace"`    // Agents that would be killed and replaced as they never registered
+	Retire    []string `json:"retire"`     // Agents that ran a job in ephemeral mode and would be removed once done
+	Recycle   []string `json:"recycle"`    // Agents older than the max lifetime that would be replaced
+}
+
+// CurrentStatus - Status of the Scalar as of its last Execute
+func CurrentStatus(s Scalar) Status {
+	history := s.history()
+	status := history.status
+	status.RegistrationFailures = history.registrationFailures
+	return status
+}
+
+func newHistory() *history {
+	return &history{
+		idleSince:        make(map[string]time.Time),
+		registered:       sets.Empty(),
+		pendingScaleDown: make(map[string]time.Time),
+		retired:          sets.Empty(),
+		replaced:         sets.Empty(),
+	}
+}
+
+// observeIdle - Records the agents that are idle as of now and forgets the ones that aren't anymore
+func (h *history) observeIdle(agentIDs []string, at time.Time) {
+	idleSince := make(map[string]time.Time, len(agentIDs))
+	for _, agentID := range agentIDs {
+		if since, seen := h.idleSince[agentID]; seen {
+			idleSince[agentID] = since
+		} else {
+			idleSince[agentID] = at
+		}
+	}
+	h.idleSince = idleSince
+}
+
+// idleFor - Agents among the given ones that have been idle for at least the duration
+func (h *history) idleFor(agentIDs []string, duration time.Duration, at time.Time) []string {
+	var agents []string
+	for _, agentID := range agentIDs {
+		if since, seen := h.idleSince[agentID]; seen && at.Sub(since) >= duration {
+			agents = append(agents, agentID)
+		}
+	}
+	return agents
+}
+
+// inScaleUpCooldown - If the last scale up happened within the cooldown
+func (h *history) inScaleUpCooldown(cooldown time.Duration, at time.Time) bool {
+	return at.Sub(h.lastScaleUp) < cooldown
+}
+
+// inScaleDownCooldown - If any scaling happened within the cooldown, so agents that were just
+// brought up aren't torn down right away
+func (h *history) inScaleDownCooldown(cooldown time.Duration, at time.Time) bool {
+	return at.Sub(h.lastScaleUp) < cooldown || at.Sub(h.lastScaleDown) < cooldown
+}
+
+// observeRegistered - Remembers the launched agents that have registered with the GoCD Server, so an agent
+// that was deleted from the server during a scale down isn't mistaken for one that never registered
+func (h *history) observeRegistered(launchTimes map[string]time.Time, registered sets.Set) {
+	stillRegistered := sets.Empty()
+	for agentID := range launchTimes {
+		if registered.Contains(agentID) || h.registered.Contains(agentID) {
+			stillRegistered.Add(agentID)
+		}
+	}
+	h.registered = stillRegistered
+}
+
+// unregistered - Launched agents that haven't registered within the timeout
+func (h *history) unregistered(launchTimes map[string]time.Time, timeout time.Duration, at time.Time) []string {
+	var agents []string
+	for agentID, launchedAt := range launchTimes {
+		if !h.registered.Contains(agentID) && at.Sub(launchedAt) >= timeout {
+			agents = append(agents, agentID)
+		}
+	}
+	sort.Strings(agents)
+	return agents
+}
+
+// recordAction - Remembers the last scaling action for the status
+func (h *history) recordAction(action string, at time.Time) {
+	h.status.LastAction = action
+	h.status.LastActionAt = at
+}
+
+// scaledUp - Counts the agents that were started, and the failure to start any of the others
+func (h *history) scaledUp(result executor.Result, err error) {
+	if err != nil || len(result.Failed) > 0 {
+		h.status.ScaleUpFailures++
+	}
+	h.status.ScaledUp += len(result.Succeeded)
+}
+
+// scaledDown - Counts the agents that were killed, and the failure to kill any of the others
+func (h *history) scaledDown(result executor.Result, err error) {
+	if err != nil || len(result.Failed) > 0 {
+		h.status.ScaleDownFailures++
+	}
+	h.status.ScaledDown += len(result.Succeeded)
+}
+
+// notPendingScaleDown - Agents among the given ones that aren't already being scaled down
+func (h *history) notPendingScaleDown(agentIDs []string) []string {
+	var agents []string
+	for _, agentID := range agentIDs {
+		if _, pending := h.pendingScaleDown[agentID]; !pending {
+			agents = append(agents, agentID)
+		}
+	}
+	return agents
+}
@@ -0,0 +1,58 @@
+package scalar
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ind9/vasuki/executor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserveIdleTracksWhenAgentsWereFirstSeenIdle(t *testing.T) {
+	h := newHistory()
+	start := time.Now()
+
+	h.observeIdle([]string{"agent-1"}, start)
+	h.observeIdle([]string{"agent-1", "agent-2"}, start.Add(time.Minute))
+
+	assert.Equal(t, start, h.idleSince["agent-1"])
+	assert.Equal(t, start.Add(time.Minute), h.idleSince["agent-2"])
+	assert.Equal(t, []string{"agent-1"}, h.idleFor([]string{"agent-1", "agent-2"}, 2*time.Minute, start.Add(2*time.Minute)))
+}
+
+func TestObserveIdleForgetsAgentsThatAreNotIdleAnymore(t *testing.T) {
+	h := newHistory()
+	start := time.Now()
+
+	h.observeIdle([]string{"agent-1"}, start)
+	h.observeIdle([]string{}, start.Add(time.Minute))
+	h.observeIdle([]string{"agent-1"}, start.Add(2*time.Minute))
+
+	assert.Equal(t, start.Add(2*time.Minute), h.idleSince["agent-1"])
+}
+
+func TestCooldowns(t *testing.T) {
+	h := newHistory()
+	start := time.Now()
+	h.lastScaleUp = start
+
+	assert.True(t, h.inScaleUpCooldown(time.Minute, start.Add(30*time.Second)))
+	assert.False(t, h.inScaleUpCooldown(time.Minute, start.Add(time.Minute)))
+	assert.True(t, h.inScaleDownCooldown(time.Minute, start.Add(30*time.Second)))
+	assert.False(t, h.inScaleDownCooldown(0, start))
+}
+
+func TestScaledUpCountsTheAgentsThatStartedDespiteFailures(t *testing.T) {
+	h := newHistory()
+
+	h.scaledUp(executor.Result{Succeeded: []string{"agent-1", "agent-2", "agent-3"}}, nil)
+	h.scaledUp(executor.Result{
+		Succeeded: []string{"agent-4", "agent-5"},
+		Failed:    map[string]error{"agent-6": errors.New("no space left on device")},
+	}, nil)
+	h.scaledUp(executor.Result{}, errors.New("image can't be pulled"))
+
+	assert.Equal(t, 5, h.status.ScaledUp)
+	assert.Equal(t, 2, h.status.ScaleUpFailures)
+}
@@ -0,0 +1,117 @@
+package scalar
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/ind9/vasuki/utils/logging"
+)
+
+// recycleOldAgents - Replaces the idle agents that were launched more than MaxLifetime ago, so the disk,
+// caches and processes they piled up go away with them. The replacements are started first, as many as
+// the max agents of the pool leave room for, and only the oldest agents that got one are disabled and
+// removed on the next tick like any other scale down. The others wait for a later tick. An agent whose
+// replacement was started but couldn't be disabled doesn't get another one. Building agents are never
+// touched, they're recycled once they're idle again.
+func recycleOldAgents(s Scalar, snapshot *Snapshot, at time.Time) error {
+	config := s.config()
+	history := s.history()
+	launchTimes, err := s.executor().LaunchTimes()
+	if err != nil {
+		return err
+	}
+	for _, agentID := range history.replaced.Values() {
+		if _, present := launchTimes[agentID]; !present {
+			history.replaced.Remove(agentID)
+		}
+	}
+	idleAgentIds, err := s.IdleAgents(snapshot)
+	if err != nil {
+		return err
+	}
+	expired := expiredAgents(history.notPendingScaleDown(idleAgentIds), launchTimes, config.MaxLifetime, at)
+	if len(expired) == 0 {
+		return nil
+	}
+
+	var replaced, unreplaced []string
+	for _, agentID := range expired {
+		if history.replaced.Contains(agentID) {
+			replaced = append(replaced, agentID)
+		} else {
+			unreplaced = append(unreplaced, agentID)
+		}
+	}
+	supply, err := s.Supply(snapshot)
+	if err != nil {
+		return err
+	}
+	instances := len(unreplaced)
+	if headroom := config.MaxAgents - supply; instances > headroom {
+		instances = headroom
+	}
+	if instances > 0 && config.Shared != nil {
+		instances = config.Shared.claim(config, supply, instances)
+	}
+	if instances < 0 {
+		instances = 0
+	}
+	if instances < len(unreplaced) {
+		logging.Log.Infof("Agents %v are older than %s, but we already have %d / %d max agents. Replacing them later.",
+			unreplaced[instances:], config.MaxLifetime, supply, config.MaxAgents)
+	}
+	if config.DryRun {
+		plan := append(replaced, unreplaced[:instances]...)
+		if len(plan) > 0 {
+			logging.Log.Infof("[dry run] Agents %v are older than %s, would replace them", plan, config.MaxLifetime)
+			history.status.Plan.Recycle = plan
+		}
+		return nil
+	}
+
+	var resultErr *multierror.Error
+	if instances > 0 {
+		started, err := s.executor().ScaleUp(instances)
+		history.scaledUp(started, err)
+		resultErr = updateErrors(resultErr, executorErr(started, err, "start"))
+		for _, agentID := range unreplaced[:len(started.Succeeded)] {
+			history.replaced.Add(agentID)
+			replaced = append(replaced, agentID)
+		}
+	}
+
+	disabled := 0
+	for _, agentID := range replaced {
+		// Deleted and killed by finishScaleDown, unless GoCD assigns it a job before noticing it was disabled
+		logging.Log.Infof("Agent %s is older than %s, disabling it to be replaced", agentID, config.MaxLifetime)
+		err := s.client().DisableAgent(agentID)
+		resultErr = updateErrors(resultErr, err)
+		if err == nil {
+			history.pendingScaleDown[agentID] = at
+			history.replaced.Remove(agentID)
+			disabled++
+		}
+	}
+	if disabled > 0 {
+		history.status.Recycled += disabled
+		history.recordAction(fmt.Sprintf("recycled %d agents older than %s", disabled, config.MaxLifetime), at)
+	}
+	return resultErr.ErrorOrNil()
+}
+
+// expiredAgents - Agents among the given ones that were launched at least maxLifetime ago, oldest first.
+// Agents without a launch time aren't ours to recycle.
+func expiredAgents(agentIDs []string, launchTimes map[string]time.Time, maxLifetime time.Duration, at time.Time) []string {
+	var expired []string
+	for _, agentID := range agentIDs {
+		if launchedAt, present := launchTimes[agentID]; present && at.Sub(launchedAt) >= maxLifetime {
+			expired = append(expired, agentID)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		return launchTimes[expired[i]].Before(launchTimes[expired[j]])
+	})
+	return expired
+}
@@ -0,0 +1,179 @@
+package scalar
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ashwanthkumar/go-gocd"
+	gocdmocks "github.com/ashwanthkumar/go-gocd/mocks"
+	"github.com/ind9/vasuki/executor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// oldAgentsSnapshot - Idle agents of all ages, and a building one
+func oldAgentsSnapshot() *Snapshot {
+	return &Snapshot{Agents: []*gocd.Agent{
+		{UUID: "young-agent", Env: TestEnv, Resources: TestResources, AgentState: "Idle", BuildState: "Idle"},
+		{UUID: "old-agent", Env: TestEnv, Resources: TestResources, AgentState: "Idle", BuildState: "Idle"},
+		{UUID: "older-agent", Env: TestEnv, Resources: TestResources, AgentState: "Idle", BuildState: "Idle"},
+		{UUID: "old-building-agent", Env: TestEnv, Resources: TestResources, AgentState: "Building", BuildState: "Building"},
+	}}
+}
+
+func newLifetimeScalar(launchTimes map[string]time.Time) (*SimpleScalar, *gocdmocks.Client, *executor.MockExecutor) {
+	scalar, client, mockExecutor := newTestScalar(func(config *Config) {
+		config.MaxLifetime = time.Hour
+		config.MaxAgents = 10
+	})
+	var managedAgents []string
+	for agentID := range launchTimes {
+		managedAgents = append(managedAgents, agentID)
+	}
+	mockExecutor.On("LaunchTimes").Return(launchTimes, nil)
+	mockExecutor.On("ManagedAgents").Return(managedAgents, nil)
+	return scalar, client, mockExecutor
+}
+
+func TestRecycleOldAgentsReplacesTheIdleAgentsPastTheirLifetime(t *testing.T) {
+	at := time.Now()
+	scalar, client, mockExecutor := newLifetimeScalar(map[string]time.Time{
+		"young-agent":        at.Add(-10 * time.Minute),
+		"old-agent":          at.Add(-2 * time.Hour),
+		"older-agent":        at.Add(-3 * time.Hour),
+		"old-building-agent": at.Add(-4 * time.Hour),
+	})
+	snapshot := oldAgentsSnapshot()
+	client.On("DisableAgent", "old-agent").Return(nil)
+	client.On("DisableAgent", "older-agent").Return(nil)
+	mockExecutor.On("ScaleUp", 2).Return(executor.Result{Succeeded: []string{"new-agent-1", "new-agent-2"}}, nil)
+
+	err := recycleOldAgents(scalar, snapshot, at)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Time{"old-agent": at, "older-agent": at}, scalar.history().pendingScaleDown)
+	assert.Equal(t, 2, scalar.history().status.Recycled)
+	assert.Equal(t, 2, scalar.history().status.ScaledUp)
+	assert.Equal(t, "recycled 2 agents older than 1h0m0s", scalar.history().status.LastAction)
+	client.AssertExpectations(t)
+	client.AssertNotCalled(t, "DisableAgent", "young-agent")
+	client.AssertNotCalled(t, "DisableAgent", "old-building-agent")
+	mockExecutor.AssertExpectations(t)
+}
+
+func TestRecycleOldAgentsOnlyDisablesTheOldestAgentsThatWereReplaced(t *testing.T) {
+	at := time.Now()
+	scalar, client, mockExecutor := newLifetimeScalar(map[string]time.Time{
+		"old-agent":   at.Add(-2 * time.Hour),
+		"older-agent": at.Add(-3 * time.Hour),
+	})
+	snapshot := oldAgentsSnapshot()
+	mockExecutor.On("ScaleUp", 2).Return(executor.Result{Succeeded: []string{"new-agent"}, Failed: map[string]error{"failed-agent": assert.AnError}}, nil)
+	client.On("DisableAgent", "older-agent").Return(nil)
+
+	err := recycleOldAgents(scalar, snapshot, at)
+	assert.Error(t, err)
+	assert.Equal(t, map[string]time.Time{"older-agent": at}, scalar.history().pendingScaleDown)
+	assert.Equal(t, 1, scalar.history().status.Recycled)
+	assert.Equal(t, 1, scalar.history().status.ScaleUpFailures)
+	client.AssertNotCalled(t, "DisableAgent", "old-agent")
+}
+
+func TestRecycleOldAgentsKeepsTheAgentsThatCouldNotBeReplaced(t *testing.T) {
+	at := time.Now()
+	scalar, client, mockExecutor := newLifetimeScalar(map[string]time.Time{
+		"old-agent":   at.Add(-2 * time.Hour),
+		"older-agent": at.Add(-3 * time.Hour),
+	})
+	snapshot := oldAgentsSnapshot()
+	scalar.history().pendingScaleDown["older-agent"] = at.Add(-time.Minute)
+	mockExecutor.On("ScaleUp", 1).Return(executor.Result{}, assert.AnError)
+
+	err := recycleOldAgents(scalar, snapshot, at)
+	assert.Error(t, err)
+	assert.Equal(t, 0, scalar.history().status.Recycled)
+	client.AssertNotCalled(t, "DisableAgent", mock.Anything)
+}
+
+func TestRecycleOldAgentsOnlyCountsTheAgentsThatWereDisabled(t *testing.T) {
+	at := time.Now()
+	scalar, client, mockExecutor := newLifetimeScalar(map[string]time.Time{
+		"old-agent": at.Add(-2 * time.Hour),
+	})
+	snapshot := oldAgentsSnapshot()
+	mockExecutor.On("ScaleUp", 1).Return(executor.Result{Succeeded: []string{"new-agent"}}, nil)
+	client.On("DisableAgent", "old-agent").Return(assert.AnError).Once()
+
+	err := recycleOldAgents(scalar, snapshot, at)
+	assert.Error(t, err)
+	assert.Empty(t, scalar.history().pendingScaleDown)
+	assert.Equal(t, 0, scalar.history().status.Recycled)
+
+	// It already has a replacement, it's only disabled on the next tick
+	client.On("DisableAgent", "old-agent").Return(nil)
+	err = recycleOldAgents(scalar, snapshot, at)
+	assert.NoError(t, err)
+	assert.Contains(t, scalar.history().pendingScaleDown, "old-agent")
+	assert.Equal(t, 1, scalar.history().status.Recycled)
+	mockExecutor.AssertNumberOfCalls(t, "ScaleUp", 1)
+}
+
+func TestRecycleOldAgentsNeverGoesOverTheMaxAgents(t *testing.T) {
+	at := time.Now()
+	scalar, client, mockExecutor := newLifetimeScalar(map[string]time.Time{
+		"young-agent":        at.Add(-10 * time.Minute),
+		"old-agent":          at.Add(-2 * time.Hour),
+		"older-agent":        at.Add(-3 * time.Hour),
+		"old-building-agent": at.Add(-4 * time.Hour),
+	})
+	snapshot := oldAgentsSnapshot()
+	scalar.config().MaxAgents = 5
+	mockExecutor.On("ScaleUp", 1).Return(executor.Result{Succeeded: []string{"new-agent"}}, nil)
+	client.On("DisableAgent", "older-agent").Return(nil)
+
+	err := recycleOldAgents(scalar, snapshot, at)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Time{"older-agent": at}, scalar.history().pendingScaleDown)
+	client.AssertNotCalled(t, "DisableAgent", "old-agent")
+
+	// At the max agents, nothing is replaced until there's room again
+	scalar.config().MaxAgents = 4
+	err = recycleOldAgents(scalar, snapshot, at)
+	assert.NoError(t, err)
+	mockExecutor.AssertNumberOfCalls(t, "ScaleUp", 1)
+	client.AssertNotCalled(t, "DisableAgent", "old-agent")
+}
+
+func TestRecycleOldAgentsClaimsTheReplacementsFromTheSharedMaxAgents(t *testing.T) {
+	at := time.Now()
+	scalar, client, mockExecutor := newLifetimeScalar(map[string]time.Time{
+		"old-agent":   at.Add(-2 * time.Hour),
+		"older-agent": at.Add(-3 * time.Hour),
+	})
+	snapshot := oldAgentsSnapshot()
+	scalar.config().Shared = NewSharedMaxAgents(6)
+	scalar.config().Shared.observe(NewConfig(TestEnv, TestResources, TestMaxAgents), 2)
+	mockExecutor.On("ScaleUp", 1).Return(executor.Result{Succeeded: []string{"new-agent"}}, nil)
+	client.On("DisableAgent", "older-agent").Return(nil)
+
+	err := recycleOldAgents(scalar, snapshot, at)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Time{"older-agent": at}, scalar.history().pendingScaleDown)
+	client.AssertNotCalled(t, "DisableAgent", "old-agent")
+}
+
+func TestDryRunPlansTheRecyclingOfOldAgents(t *testing.T) {
+	at := time.Now()
+	scalar, client, mockExecutor := newLifetimeScalar(map[string]time.Time{
+		"old-agent":   at.Add(-2 * time.Hour),
+		"older-agent": at.Add(-3 * time.Hour),
+	})
+	snapshot := oldAgentsSnapshot()
+	scalar.config().DryRun = true
+	scalar.history().status.Plan = &Plan{}
+
+	err := recycleOldAgents(scalar, snapshot, at)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"older-agent", "old-agent"}, scalar.history().status.Plan.Recycle)
+	client.AssertNotCalled(t, "DisableAgent", mock.Anything)
+	mockExecutor.AssertNotCalled(t, "ScaleUp", mock.Anything)
+}
@@ -3,6 +3,7 @@ package scalar
 import "github.com/stretchr/testify/mock"
 
 import "github.com/ashwanthkumar/go-gocd"
+import "github.com/ind9/vasuki/executor"
 
 type MockScalar struct {
 	mock.Mock
@@ -38,15 +39,47 @@ func (_m *MockScalar) client() gocd.Client {
 	return r0
 }
 
-// Demand provides a mock function with given fields:
-func (_m *MockScalar) Demand() (int, error) {
+// executor provides a mock function with given fields:
+func (_m *MockScalar) executor() executor.Executor {
 	ret := _m.Called()
 
-	var r0 int
-	if rf, ok := ret.Get(0).(func() int); ok {
+	var r0 executor.Executor
+	if rf, ok := ret.Get(0).(func() executor.Executor); ok {
 		r0 = rf()
 	} else {
-		r0 = ret.Get(0).(int)
+		r0 = ret.Get(0).(executor.Executor)
+	}
+
+	return r0
+}
+
+// history provides a mock function with given fields:
+func (_m *MockScalar) history() *history {
+	ret := _m.Called()
+
+	var r0 *history
+	if rf, ok := ret.Get(0).(func() *history); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*history)
+		}
+	}
+
+	return r0
+}
+
+// Snapshot provides a mock function with given fields:
+func (_m *MockScalar) Snapshot() (*Snapshot, error) {
+	ret := _m.Called()
+
+	var r0 *Snapshot
+	if rf, ok := ret.Get(0).(func() *Snapshot); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*Snapshot)
+		}
 	}
 
 	var r1 error
@@ -59,20 +92,20 @@ func (_m *MockScalar) Demand() (int, error) {
 	return r0, r1
 }
 
-// Supply provides a mock function with given fields:
-func (_m *MockScalar) Supply() (int, error) {
-	ret := _m.Called()
+// Demand provides a mock function with given fields: snapshot
+func (_m *MockScalar) Demand(snapshot *Snapshot) (int, error) {
+	ret := _m.Called(snapshot)
 
 	var r0 int
-	if rf, ok := ret.Get(0).(func() int); ok {
-		r0 = rf()
+	if rf, ok := ret.Get(0).(func(*Snapshot) int); ok {
+		r0 = rf(snapshot)
 	} else {
 		r0 = ret.Get(0).(int)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func() error); ok {
-		r1 = rf()
+	if rf, ok := ret.Get(1).(func(*Snapshot) error); ok {
+		r1 = rf(snapshot)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -80,13 +113,34 @@ func (_m *MockScalar) Supply() (int, error) {
 	return r0, r1
 }
 
-// IdleAgents provides a mock function with given fields:
-func (_m *MockScalar) IdleAgents() ([]string, error) {
-	ret := _m.Called()
+// Supply provides a mock function with given fields: snapshot
+func (_m *MockScalar) Supply(snapshot *Snapshot) (int, error) {
+	ret := _m.Called(snapshot)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(*Snapshot) int); ok {
+		r0 = rf(snapshot)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*Snapshot) error); ok {
+		r1 = rf(snapshot)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// IdleAgents provides a mock function with given fields: snapshot
+func (_m *MockScalar) IdleAgents(snapshot *Snapshot) ([]string, error) {
+	ret := _m.Called(snapshot)
 
 	var r0 []string
-	if rf, ok := ret.Get(0).(func() []string); ok {
-		r0 = rf()
+	if rf, ok := ret.Get(0).(func(*Snapshot) []string); ok {
+		r0 = rf(snapshot)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]string)
@@ -94,8 +148,8 @@ func (_m *MockScalar) IdleAgents() ([]string, error) {
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func() error); ok {
-		r1 = rf()
+	if rf, ok := ret.Get(1).(func(*Snapshot) error); ok {
+		r1 = rf(snapshot)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -0,0 +1,108 @@
+package scalar
+
+import (
+	"fmt"
+	"math"
+)
+
+// Capacity - Demand and supply of agents a ScalingPolicy decides on
+type Capacity struct {
+	Demand    int // Includes the warm pool
+	Supply    int
+	Idle      int
+	MaxAgents int
+}
+
+// Decision of a ScalingPolicy, only one of them is non zero
+type Decision struct {
+	ScaleUp   int
+	ScaleDown int
+}
+
+// ScalingPolicy - Decides how many agents to scale up or down by. The decision is capped
+// to MaxAgents and the idle agents by Decide, so policies only deal with the step size.
+type ScalingPolicy interface {
+	Decide(capacity Capacity) Decision
+}
+
+// HalfStep - Scales by half the difference between demand and supply
+type HalfStep struct{}
+
+// Decide - ScalingPolicy implementation
+func (p *HalfStep) Decide(capacity Capacity) Decision {
+	return proportionally(capacity, 0.5)
+}
+
+// AllAtOnce - Scales by the entire difference between demand and supply
+type AllAtOnce struct{}
+
+// Decide - ScalingPolicy implementation
+func (p *AllAtOnce) Decide(capacity Capacity) Decision {
+	return proportionally(capacity, 1)
+}
+
+// FixedStep - Scales by at most Step agents at a time
+type FixedStep struct {
+	Step int
+}
+
+// Decide - ScalingPolicy implementation
+func (p *FixedStep) Decide(capacity Capacity) Decision {
+	diff := capacity.Demand - capacity.Supply
+	if diff > 0 {
+		return Decision{ScaleUp: int(math.Min(float64(diff), float64(p.Step)))}
+	}
+	return Decision{ScaleDown: int(math.Min(float64(-diff), float64(p.Step)))}
+}
+
+// Proportional - Scales by Factor times the difference between demand and supply
+type Proportional struct {
+	Factor float64
+}
+
+// Decide - ScalingPolicy implementation
+func (p *Proportional) Decide(capacity Capacity) Decision {
+	return proportionally(capacity, p.Factor)
+}
+
+// NewScalingPolicy - Creates one of the built in policies by name. Step is used by
+// fixed-step and factor (0, 1] by proportional, the others ignore them.
+func NewScalingPolicy(name string, step int, factor float64) (ScalingPolicy, error) {
+	switch name {
+	case "", "half-step":
+		return &HalfStep{}, nil
+	case "all-at-once":
+		return &AllAtOnce{}, nil
+	case "fixed-step":
+		if step < 1 {
+			return nil, fmt.Errorf("scaling step must be at least 1, found %d", step)
+		}
+		return &FixedStep{Step: step}, nil
+	case "proportional":
+		if factor <= 0 || factor > 1 {
+			return nil, fmt.Errorf("scaling factor must be within (0, 1], found %g", factor)
+		}
+		return &Proportional{Factor: factor}, nil
+	}
+	return nil, fmt.Errorf("Unknown scaling policy %q, available policies are half-step, all-at-once, fixed-step, proportional", name)
+}
+
+// Decide - Decision of the policy capped to the MaxAgents on scale up, and
+// to the idle agents without going below the demand on scale down
+func Decide(policy ScalingPolicy, capacity Capacity) Decision {
+	decision := policy.Decide(capacity)
+	if capacity.Demand > capacity.Supply {
+		headroom := int(math.Max(float64(capacity.MaxAgents-capacity.Supply), 0))
+		return Decision{ScaleUp: int(math.Min(float64(decision.ScaleUp), float64(headroom)))}
+	}
+	excess := capacity.Supply - capacity.Demand
+	return Decision{ScaleDown: int(math.Min(float64(decision.ScaleDown), math.Min(float64(excess), float64(capacity.Idle))))}
+}
+
+func proportionally(capacity Capacity, factor float64) Decision {
+	diff := capacity.Demand - capacity.Supply
+	if diff > 0 {
+		return Decision{ScaleUp: int(math.Ceil(float64(diff) * factor))}
+	}
+	return Decision{ScaleDown: int(math.Ceil(float64(-diff) * factor))}
+}
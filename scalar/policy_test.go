@@ -0,0 +1,65 @@
+package scalar
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHalfStepPolicy(t *testing.T) {
+	policy := &HalfStep{}
+
+	assert.Equal(t, Decision{ScaleUp: 3}, Decide(policy, Capacity{Demand: 5, Supply: 0, MaxAgents: 10}))
+	assert.Equal(t, Decision{ScaleDown: 2}, Decide(policy, Capacity{Demand: 1, Supply: 5, Idle: 4, MaxAgents: 10}))
+}
+
+func TestAllAtOncePolicy(t *testing.T) {
+	policy := &AllAtOnce{}
+
+	assert.Equal(t, Decision{ScaleUp: 5}, Decide(policy, Capacity{Demand: 5, Supply: 0, MaxAgents: 10}))
+	assert.Equal(t, Decision{ScaleDown: 4}, Decide(policy, Capacity{Demand: 1, Supply: 5, Idle: 4, MaxAgents: 10}))
+}
+
+func TestFixedStepPolicy(t *testing.T) {
+	policy := &FixedStep{Step: 2}
+
+	assert.Equal(t, Decision{ScaleUp: 2}, Decide(policy, Capacity{Demand: 5, Supply: 0, MaxAgents: 10}))
+	assert.Equal(t, Decision{ScaleUp: 1}, Decide(policy, Capacity{Demand: 5, Supply: 4, MaxAgents: 10}))
+	assert.Equal(t, Decision{ScaleDown: 2}, Decide(policy, Capacity{Demand: 1, Supply: 5, Idle: 4, MaxAgents: 10}))
+}
+
+func TestProportionalPolicy(t *testing.T) {
+	policy := &Proportional{Factor: 0.25}
+
+	assert.Equal(t, Decision{ScaleUp: 2}, Decide(policy, Capacity{Demand: 8, Supply: 0, MaxAgents: 10}))
+	assert.Equal(t, Decision{ScaleDown: 1}, Decide(policy, Capacity{Demand: 1, Supply: 5, Idle: 4, MaxAgents: 10}))
+}
+
+func TestDecideCapsTheDecision(t *testing.T) {
+	policy := &AllAtOnce{}
+
+	assert.Equal(t, Decision{ScaleUp: 3}, Decide(policy, Capacity{Demand: 10, Supply: 2, MaxAgents: 5}))
+	assert.Equal(t, Decision{ScaleUp: 0}, Decide(policy, Capacity{Demand: 10, Supply: 6, MaxAgents: 5}))
+	assert.Equal(t, Decision{ScaleDown: 1}, Decide(policy, Capacity{Demand: 0, Supply: 5, Idle: 1, MaxAgents: 5}))
+}
+
+func TestNewScalingPolicy(t *testing.T) {
+	policy, err := NewScalingPolicy("", 0, 0)
+	assert.NoError(t, err)
+	assert.IsType(t, &HalfStep{}, policy)
+
+	policy, err = NewScalingPolicy("fixed-step", 3, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, &FixedStep{Step: 3}, policy)
+
+	policy, err = NewScalingPolicy("proportional", 0, 0.75)
+	assert.NoError(t, err)
+	assert.Equal(t, &Proportional{Factor: 0.75}, policy)
+
+	_, err = NewScalingPolicy("fixed-step", 0, 0)
+	assert.Error(t, err)
+	_, err = NewScalingPolicy("proportional", 0, 1.5)
+	assert.Error(t, err)
+	_, err = NewScalingPolicy("exponential", 0, 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,56 @@
+package scalar
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/ind9/vasuki/utils/logging"
+)
+
+// replaceUnregisteredAgents - Kills the agents that didn't register with the GoCD Server within the
+// RegistrationTimeout of their launch and launches a replacement for each of them. Their logs are
+// captured before they're killed, since that's usually the only trace of why they never made it.
+func replaceUnregisteredAgents(s Scalar, snapshot *Snapshot, at time.Time) error {
+	config := s.config()
+	history := s.history()
+	launchTimes, err := s.executor().LaunchTimes()
+	if err != nil {
+		return err
+	}
+	history.observeRegistered(launchTimes, snapshot.registered())
+
+	unregistered := history.unregistered(launchTimes, config.RegistrationTimeout, at)
+	if len(unregistered) == 0 {
+		return nil
+	}
+	if config.DryRun {
+		logging.Log.Infof("[dry run] Agents %v didn't register with the Go Server within %s, would kill and replace them", unregistered, config.RegistrationTimeout)
+		history.status.Plan.Replace = unregistered
+		return nil
+	}
+	for _, agentID := range unregistered {
+		history.registrationFailures++
+		logging.Log.Warningf("Agent %s didn't register with the Go Server within %s, replacing it (%d registration failures so far)",
+			agentID, config.RegistrationTimeout, history.registrationFailures)
+		logs, err := s.executor().Logs(agentID)
+		if err != nil {
+			logging.Log.Warningf("Couldn't capture the logs of agent %s: %s", agentID, err)
+		} else {
+			logging.Log.Warningf("Logs of agent %s:\n%s", agentID, logs)
+		}
+	}
+
+	var resultErr *multierror.Error
+	killed, err := s.executor().ScaleDown(unregistered)
+	history.scaledDown(killed, err)
+	resultErr = updateErrors(resultErr, executorErr(killed, err, "kill"))
+	// Only the agents that were killed are replaced, the others are retried on the next tick
+	if len(killed.Succeeded) > 0 {
+		started, err := s.executor().ScaleUp(len(killed.Succeeded))
+		history.scaledUp(started, err)
+		resultErr = updateErrors(resultErr, executorErr(started, err, "start"))
+		history.recordAction(fmt.Sprintf("replaced %d unregistered agents", len(killed.Succeeded)), at)
+	}
+	return resultErr.ErrorOrNil()
+}
@@ -0,0 +1,112 @@
+package scalar
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ind9/vasuki/executor"
+	"github.com/ind9/vasuki/utils/sets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// newRegistrationScalar - Scalar with a registration timeout, whose executor launched agents at the given times
+func newRegistrationScalar(launchTimes map[string]time.Time) (*SimpleScalar, *executor.MockExecutor) {
+	scalar, _, mockExecutor := newTestScalar(func(config *Config) {
+		config.RegistrationTimeout = 5 * time.Minute
+	})
+	mockExecutor.On("LaunchTimes").Return(launchTimes, nil)
+	return scalar, mockExecutor
+}
+
+func TestReplaceUnregisteredAgentsKillsAndReplacesAgentsPastTheDeadline(t *testing.T) {
+	at := time.Now()
+	launchTimes := map[string]time.Time{
+		"registered-agent": at.Add(-10 * time.Minute),
+		"stuck-agent":      at.Add(-6 * time.Minute),
+		"booting-agent":    at.Add(-time.Minute),
+	}
+	scalar, mockExecutor := newRegistrationScalar(launchTimes)
+	h, snapshot := scalar.history(), snapshotOf("registered-agent")
+	mockExecutor.On("Logs", "stuck-agent").Return("Couldn't download agent-launcher.jar", nil)
+	mockExecutor.On("ScaleDown", []string{"stuck-agent"}).Return(executor.Result{Succeeded: []string{"stuck-agent"}}, nil)
+	mockExecutor.On("ScaleUp", 1).Return(executor.Result{Succeeded: []string{"new-agent-1"}}, nil)
+
+	err := replaceUnregisteredAgents(scalar, snapshot, at)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, h.registrationFailures)
+	mockExecutor.AssertExpectations(t)
+}
+
+func TestReplaceUnregisteredAgentsOnlyReplacesTheAgentsThatWereKilled(t *testing.T) {
+	at := time.Now()
+	launchTimes := map[string]time.Time{
+		"stuck-agent":  at.Add(-6 * time.Minute),
+		"zombie-agent": at.Add(-7 * time.Minute),
+	}
+	scalar, mockExecutor := newRegistrationScalar(launchTimes)
+	h, snapshot := scalar.history(), snapshotOf()
+	mockExecutor.On("Logs", mock.Anything).Return("", nil)
+	mockExecutor.On("ScaleDown", []string{"stuck-agent", "zombie-agent"}).Return(executor.Result{
+		Succeeded: []string{"stuck-agent"},
+		Failed:    map[string]error{"zombie-agent": errors.New("container is not running")},
+	}, nil)
+	mockExecutor.On("ScaleUp", 1).Return(executor.Result{Succeeded: []string{"new-agent-1"}}, nil)
+
+	err := replaceUnregisteredAgents(scalar, snapshot, at)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "zombie-agent")
+	assert.Equal(t, 1, h.status.ScaledDown)
+	assert.Equal(t, 1, h.status.ScaleDownFailures)
+	assert.Equal(t, 1, h.status.ScaledUp)
+	mockExecutor.AssertExpectations(t)
+}
+
+func TestReplaceUnregisteredAgentsDoesNothingWhenAllAgentsRegistered(t *testing.T) {
+	at := time.Now()
+	launchTimes := map[string]time.Time{
+		"registered-agent": at.Add(-10 * time.Minute),
+	}
+	scalar, mockExecutor := newRegistrationScalar(launchTimes)
+	h, snapshot := scalar.history(), snapshotOf("registered-agent")
+
+	err := replaceUnregisteredAgents(scalar, snapshot, at)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, h.registrationFailures)
+	mockExecutor.AssertNotCalled(t, "ScaleDown", []string{"registered-agent"})
+	mockExecutor.AssertNotCalled(t, "ScaleUp", 1)
+}
+
+func TestReplaceUnregisteredAgentsDoesNotReplaceAgentsThatRegisteredBefore(t *testing.T) {
+	at := time.Now()
+	launchTimes := map[string]time.Time{
+		"agent-1": at.Add(-10 * time.Minute),
+	}
+	scalar, mockExecutor := newRegistrationScalar(launchTimes)
+	h, snapshot := scalar.history(), snapshotOf("agent-1")
+	assert.NoError(t, replaceUnregisteredAgents(scalar, snapshot, at))
+
+	// agent-1 was deleted from the Go Server on scale down, but its container is still around
+	h.observeRegistered(launchTimes, sets.Empty())
+
+	assert.Empty(t, h.unregistered(launchTimes, 5*time.Minute, at.Add(time.Minute)))
+	mockExecutor.AssertNotCalled(t, "ScaleUp", 1)
+}
+
+func TestDryRunPlansTheReplacementOfUnregisteredAgents(t *testing.T) {
+	at := time.Now()
+	launchTimes := map[string]time.Time{
+		"stuck-agent": at.Add(-6 * time.Minute),
+	}
+	scalar, mockExecutor := newRegistrationScalar(launchTimes)
+	h, snapshot := scalar.history(), snapshotOf()
+	scalar.config().DryRun = true
+	h.status.Plan = &Plan{}
+
+	assert.NoError(t, replaceUnregisteredAgents(scalar, snapshot, at))
+	assert.Equal(t, []string{"stuck-agent"}, h.status.Plan.Replace)
+	assert.Equal(t, 0, h.registrationFailures)
+	mockExecutor.AssertNotCalled(t, "ScaleDown", []string{"stuck-agent"})
+	mockExecutor.AssertNotCalled(t, "ScaleUp", 1)
+}
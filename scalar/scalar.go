@@ -1,7 +1,7 @@
 package scalar
 
 import (
-	"math"
+	"fmt"
 
 	"github.com/ashwanthkumar/go-gocd"
 	"github.com/hashicorp/go-multierror"
@@ -16,12 +16,18 @@ type Scalar interface {
 	config() *Config
 	// Instance of the GoCD Client
 	client() gocd.Client
+	// Instance of the Executor that brings up the agents
+	executor() executor.Executor
+	// Scaling activity carried across ticks
+	history() *history
+	// State of the GoCD Server for the current tick
+	Snapshot() (*Snapshot, error)
 	// Compute the demand of the GoCD sever
-	Demand() (int, error)
+	Demand(snapshot *Snapshot) (int, error)
 	// Compute the supply of agents to GoCD Server
-	Supply() (int, error)
+	Supply(snapshot *Snapshot) (int, error)
 
-	IdleAgents() ([]string, error)
+	IdleAgents(snapshot *Snapshot) ([]string, error)
 
 	// Compute the number of agents to scale up given demand and supply
 	ComputeScaleUp(demand int, supply int) (int, error)
@@ -31,17 +37,21 @@ type Scalar interface {
 
 // SimpleScalar implementation
 type SimpleScalar struct {
-	_config *Config
-	_client gocd.Client
+	_config   *Config
+	_client   gocd.Client
+	_executor executor.Executor
+	_history  *history
 }
 
 // NewSimpleScalar - Creates a new scalar.SimpleScalar instance
-func NewSimpleScalar(env []string, resources []string,
-	maxAgents int,
-	client gocd.Client) (Scalar, error) {
+func NewSimpleScalar(config *Config,
+	client gocd.Client,
+	executorImpl executor.Executor) (Scalar, error) {
 	return &SimpleScalar{
-		_config: NewConfig(env, resources, maxAgents),
-		_client: client,
+		_config:   config,
+		_client:   client,
+		_executor: executorImpl,
+		_history:  newHistory(),
 	}, nil
 }
 
@@ -53,24 +63,40 @@ func (s *SimpleScalar) client() gocd.Client {
 	return s._client
 }
 
+func (s *SimpleScalar) executor() executor.Executor {
+	return s._executor
+}
+
+func (s *SimpleScalar) history() *history {
+	return s._history
+}
+
+// Snapshot of the GoCD Server, see TakeSnapshot
+func (s *SimpleScalar) Snapshot() (*Snapshot, error) {
+	return TakeSnapshot(s.client())
+}
+
 // Demand in GoCD Server based on ScheduledJobs + Agents that're building
-func (s *SimpleScalar) Demand() (int, error) {
-	var resultErr *multierror.Error
-	pendingJobs, err := s.ScheduledJobs() // demand - from Job Queue
-	resultErr = updateErrors(resultErr, err)
-	buildingAgents, err := s.BuildingAgents() // demand - from from Agent Queu
-	resultErr = updateErrors(resultErr, err)
+func (s *SimpleScalar) Demand(snapshot *Snapshot) (int, error) {
+	pendingJobs := s.ScheduledJobs(snapshot)     // demand - from Job Queue
+	buildingAgents := s.BuildingAgents(snapshot) // demand - from from Agent Queu
 
 	demand := len(pendingJobs) + len(buildingAgents)
-	return demand, resultErr.ErrorOrNil()
+	if s.config().Ephemeral {
+		// Building agents are removed once done, they're neither supply nor demand for the jobs to come
+		demand = len(pendingJobs)
+	}
+	s.history().status.Queued = len(pendingJobs)
+	s.history().status.Building = len(buildingAgents)
+	return demand, nil
 }
 
-// Supply in GoCD Server based on Idle agents + DefaultExecutor's ManagedAgents
-func (s *SimpleScalar) Supply() (int, error) {
+// Supply in GoCD Server based on Idle agents + Executor's ManagedAgents
+func (s *SimpleScalar) Supply(snapshot *Snapshot) (int, error) {
 	var resultErr *multierror.Error
-	idleAgentIds, err := s.IdleAgents() // supply - from GoCD Server
+	idleAgentIds, err := s.IdleAgents(snapshot) // supply - from GoCD Server
 	resultErr = updateErrors(resultErr, err)
-	executorReportedAgentIds, err := executor.DefaultExecutor.ManagedAgents() // supply - from Executor instance
+	executorReportedAgentIds, err := s.executor().ManagedAgents() // supply - from Executor instance
 	resultErr = updateErrors(resultErr, err)
 	if resultErr.ErrorOrNil() != nil {
 		return 0, resultErr.ErrorOrNil()
@@ -81,93 +107,155 @@ func (s *SimpleScalar) Supply() (int, error) {
 	return supplyAgents.Size(), resultErr.ErrorOrNil()
 }
 
-// ComputeScaleUp number of agents given demand and supply
+// ComputeScaleUp number of agents given demand (including the warm pool) and supply, as per the scaling policy.
+// In ephemeral mode all of the missing agents are started at once, whatever the policy.
 func (s *SimpleScalar) ComputeScaleUp(demand int, supply int) (instances int, err error) {
-	diff := demand - supply
 	config := s.config()
-	instances = int(math.Ceil(float64(diff) / 2))
-	if supply >= config.MaxAgents {
-		instances = 0
-	} else if supply+instances > config.MaxAgents {
-		instances = config.MaxAgents - supply
+	policy := config.Policy
+	if config.Ephemeral {
+		// Every queued job gets an agent of its own right away
+		policy = &AllAtOnce{}
 	}
-
-	return instances, err
+	decision := Decide(policy, Capacity{Demand: demand, Supply: supply, MaxAgents: config.MaxAgents})
+	return decision.ScaleUp, err
 }
 
-// ComputeScaleDown number of agents given demand, supply and idleAgents
+// ComputeScaleDown number of agents given demand (including the warm pool), supply and idleAgents, as per the
+// scaling policy. Never goes below the demand, so the warm pool is always kept.
 func (s *SimpleScalar) ComputeScaleDown(demand int, supply int, idleAgents int) (instances int, err error) {
-	if idleAgents > 0 {
-		diff := supply - demand
-		instances = int(math.Min(math.Ceil(float64(diff)/2), float64(idleAgents)))
-		return instances, err
-	}
-	return 0, err
+	config := s.config()
+	decision := Decide(config.Policy, Capacity{Demand: demand, Supply: supply, Idle: idleAgents, MaxAgents: config.MaxAgents})
+	return decision.ScaleDown, err
 }
 
-// Execute - Entry point of the Scalar
+// Execute - Entry point of the Scalar. In dry run mode nothing is changed on the GoCD Server or the
+// executor, what would've been done is logged and kept in the Plan of the status instead.
 func Execute(s Scalar) error {
 	var resultErr *multierror.Error
 
 	config := s.config()
-	demand, err := s.Demand()
-	resultErr = updateErrors(resultErr, err)
-	supply, err := s.Supply()
-	resultErr = updateErrors(resultErr, err)
-	if resultErr.ErrorOrNil() != nil {
-		return resultErr.ErrorOrNil()
+	history := s.history()
+	history.status.Plan = nil
+	if config.DryRun {
+		history.status.Plan = &Plan{}
+	}
+	if len(history.pendingScaleDown) > 0 {
+		// Agents disabled on an earlier tick are only removed once GoCD has had the time to assign them a job
+		err := finishScaleDown(s)
+		resultErr = updateErrors(resultErr, err)
+	}
+	// Taken after the scale down is finished, so it doesn't have the agents that were just deleted
+	snapshot, err := s.Snapshot()
+	if err != nil {
+		return updateErrors(resultErr, err).ErrorOrNil()
+	}
+	if config.RegistrationTimeout > 0 {
+		// Agents that never registered count towards the supply, so they're replaced before it's computed
+		err := replaceUnregisteredAgents(s, snapshot, now())
+		resultErr = updateErrors(resultErr, err)
+	}
+	if config.GarbageCollectionInterval > 0 && now().Sub(history.lastGarbageCollection) >= config.GarbageCollectionInterval {
+		err := collectGarbage(s, snapshot, now())
+		resultErr = updateErrors(resultErr, err)
+	}
+	if config.Ephemeral {
+		// Agents that ran a job are disabled before the supply is computed, they won't take another one
+		err := retireUsedAgents(s, snapshot, now())
+		resultErr = updateErrors(resultErr, err)
+	}
+	if config.MaxLifetime > 0 {
+		err := recycleOldAgents(s, snapshot, now())
+		resultErr = updateErrors(resultErr, err)
+	}
+	demand, demandErr := s.Demand(snapshot)
+	supply, supplyErr := s.Supply(snapshot)
+	if demandErr != nil || supplyErr != nil {
+		resultErr = updateErrors(resultErr, demandErr)
+		return updateErrors(resultErr, supplyErr).ErrorOrNil()
 	}
 
+	// Agents whose scale down couldn't be finished are disabled, so they can't take any work
+	supply -= len(history.pendingScaleDown)
+	at := now()
+	history.status.Demand = demand
+	history.status.Supply = supply
+	history.status.Idle = 0
+	if config.Shared != nil {
+		config.Shared.observe(config, supply)
+	}
 	logging.Log.Debugf("Jobs in Queue (aka) Demand=%d", demand)
 	logging.Log.Debugf("Reporting Agents (aka) Supply=%d", supply)
-	if demand > supply {
-		instancesToScaleUp, _ := s.ComputeScaleUp(demand, supply)
+	wanted := config.wanted(demand)
+	if config.MinAgents > 0 {
+		logging.Log.Debugf("Demand including a warm pool of %d agents=%d", config.MinAgents, wanted)
+	}
+	var idleAgentIds []string
+	if config.MinIdleTime > 0 || supply > wanted {
+		// Agents are tracked on every tick when they've to be idle for a while before they can be removed
+		idleAgentIds, err = s.IdleAgents(snapshot)
+		resultErr = updateErrors(resultErr, err)
+		history.observeIdle(idleAgentIds, at)
+		history.status.Idle = len(idleAgentIds)
+	}
+
+	if wanted > supply {
+		instancesToScaleUp, _ := s.ComputeScaleUp(wanted, supply)
+		if instancesToScaleUp > 0 && config.Shared != nil && !history.inScaleUpCooldown(config.ScaleUpCooldown, at) {
+			// Claimed only when it's going to scale up, dry runs included, so the other profiles see the same plan
+			if claimed := config.Shared.claim(config, supply, instancesToScaleUp); claimed < instancesToScaleUp {
+				logging.Log.Infof("Found demand with Env=%v, Resources=%v, but the profiles of the pool have %d max agents between them. Scaling up by %d instead of %d.",
+					config.Env, config.Resources, config.Shared.Max, claimed, instancesToScaleUp)
+				instancesToScaleUp = claimed
+			}
+		}
 		if instancesToScaleUp == 0 {
 			logging.Log.Infof("Found demand with Env=%v, Resources=%v, but we already have %d / %d max agents. Not scaling up.", config.Env, config.Resources, supply, config.MaxAgents)
+		} else if history.inScaleUpCooldown(config.ScaleUpCooldown, at) {
+			logging.Log.Infof("Found demand with Env=%v, Resources=%v, but we scaled up within the last %s. Not scaling up.", config.Env, config.Resources, config.ScaleUpCooldown)
+		} else if config.DryRun {
+			logging.Log.Infof("[dry run] Found demand with Env=%v, Resources=%v, would start %d agents.", config.Env, config.Resources, instancesToScaleUp)
+			history.status.Plan.ScaleUp = instancesToScaleUp
 		} else {
 			logging.Log.Infof("Found demand with Env=%v, Resources=%v, scaling up by %d instances.\n", config.Env, config.Resources, instancesToScaleUp)
-			err = executor.DefaultExecutor.ScaleUp(instancesToScaleUp)
-			resultErr = updateErrors(resultErr, err)
+			result, err := s.executor().ScaleUp(instancesToScaleUp)
+			history.scaledUp(result, err)
+			resultErr = updateErrors(resultErr, executorErr(result, err, "start"))
+			if len(result.Succeeded) > 0 {
+				// A scale up that started nothing is retried on the next tick, regardless of the cooldown
+				history.lastScaleUp = at
+				history.recordAction(fmt.Sprintf("scaled up by %d", len(result.Succeeded)), at)
+			}
 		}
-	} else if supply > demand {
-		idleAgentIds, err := s.IdleAgents()
-		idleAgents := len(idleAgentIds)
-		instancesToScaleDown, _ := s.ComputeScaleDown(demand, supply, idleAgents)
+	} else if supply > wanted {
+		eligibleAgentIds := history.idleFor(history.notPendingScaleDown(idleAgentIds), config.MinIdleTime, at)
+		idleAgents := len(eligibleAgentIds)
+		instancesToScaleDown, _ := s.ComputeScaleDown(wanted, supply, idleAgents)
 
-		if instancesToScaleDown > 0 {
+		if instancesToScaleDown > 0 && history.inScaleDownCooldown(config.ScaleDownCooldown, at) {
+			logging.Log.Infof("Found excess supply for Env=%v, Resources=%v, but we scaled within the last %s. Not scaling down.", config.Env, config.Resources, config.ScaleDownCooldown)
+		} else if instancesToScaleDown > 0 && config.DryRun {
+			candidates := eligibleAgentIds[0:instancesToScaleDown]
+			logging.Log.Infof("[dry run] Found excess supply for Env=%v, Resources=%v, would disable, delete and kill the agents %v unless they start building.", config.Env, config.Resources, candidates)
+			history.status.Plan.ScaleDown = candidates
+		} else if instancesToScaleDown > 0 {
 			logging.Log.Infof("Found excess supply for Env=%v, Resources=%v. # of Idle Agents = %d.", config.Env, config.Resources, idleAgents)
 			logging.Log.Infof("# of Agents Scaling down = %d", instancesToScaleDown)
-			candidates := idleAgentIds[0:instancesToScaleDown]
-			var agentsToKill []string
+			candidates := eligibleAgentIds[0:instancesToScaleDown]
+			history.lastScaleDown = at
 			for _, agentID := range candidates {
+				// The agent is only deleted on a later tick, see finishScaleDown
 				logging.Log.Infof("Disabling the agent %s on Go Server\n", agentID)
 				err = s.client().DisableAgent(agentID)
 				resultErr = updateErrors(resultErr, err)
-				logging.Log.Debugf("Checking if the disabled agent %s has started building", agentID)
-				agent, err := s.client().GetAgent(agentID)
-				resultErr = updateErrors(resultErr, err)
-				if agent.BuildState != "Building" {
-					logging.Log.Debugf("Disabled agent %s is in %s state so deleting it", agentID, agent.BuildState)
-					logging.Log.Infof("Deleting the agent %s on Go Server\n", agentID)
-					err = s.client().DeleteAgent(agentID)
-					resultErr = updateErrors(resultErr, err)
-					agentsToKill = append(agentsToKill, agentID)
-				} else {
-					// Agent has started building after we disabled it, enabling it back
-					logging.Log.Noticef("Agent %s has started building after it was disabled, enabling it back", agentID)
-					err = s.client().EnableAgent(agentID)
-					resultErr = updateErrors(resultErr, err)
+				if err == nil {
+					history.pendingScaleDown[agentID] = at
 				}
 			}
-
-			if len(agentsToKill) > 0 {
-				err = executor.DefaultExecutor.ScaleDown(agentsToKill)
-				resultErr = updateErrors(resultErr, err)
-			}
+			history.recordAction(fmt.Sprintf("disabled %d agents to scale down", len(candidates)), at)
 		} else {
 			logging.Log.Infof("All agents are busy. Waiting for them to complete work.")
 		}
-	} else if supply == 0 && demand == 0 {
+	} else if supply == 0 && wanted == 0 {
 		logging.Log.Info("No demand / supply was found.")
 	} else {
 		// When all the demand is scheduledJobs then upscaled agent's haven't registered with
@@ -180,57 +268,55 @@ func Execute(s Scalar) error {
 }
 
 // ScheduledJobs - Get array of ScheduledJob that match our environment, resource combination
-func (s *SimpleScalar) ScheduledJobs() ([]*gocd.ScheduledJob, error) {
+func (s *SimpleScalar) ScheduledJobs(snapshot *Snapshot) []*gocd.ScheduledJob {
 	config := s.config()
-	jobs, err := s.client().GetScheduledJobs()
-	if err == nil {
-		filteredJobs := jobs[:0]
-		for _, job := range jobs {
-			if config.matchJob(job.Environment, job.Resources()) {
-				filteredJobs = append(filteredJobs, job)
-			}
+	var filteredJobs []*gocd.ScheduledJob
+	for _, job := range snapshot.ScheduledJobs {
+		if config.matchJob(job.Environment, job.Resources()) {
+			filteredJobs = append(filteredJobs, job)
 		}
-		return filteredJobs, nil
 	}
-	return []*gocd.ScheduledJob{}, err
+	return filteredJobs
 }
 
 // IdleAgents - Get array of Agents that match our environment, resource combination
-func (s *SimpleScalar) IdleAgents() ([]string, error) {
+func (s *SimpleScalar) IdleAgents(snapshot *Snapshot) ([]string, error) {
 	config := s.config()
-	agents, err := s.client().GetAllAgents()
 	var idleAgents []string
-	if err == nil {
-		for _, agent := range agents {
-			if config.matchAgent(agent.Env, agent.Resources) &&
-				(agent.BuildState == "Idle" || agent.BuildState == "Unknown") &&
-				(agent.AgentState == "Idle" || agent.AgentState == "Unknown") {
-				idleAgents = append(idleAgents, agent.UUID)
-			}
+	for _, agent := range snapshot.Agents {
+		if config.matchAgent(agent.Env, agent.Resources) &&
+			(agent.BuildState == "Idle" || agent.BuildState == "Unknown") &&
+			(agent.AgentState == "Idle" || agent.AgentState == "Unknown") {
+			idleAgents = append(idleAgents, agent.UUID)
 		}
-
-		return idleAgents, nil
 	}
-	return idleAgents, err
+	return idleAgents, nil
 }
 
 // BuildingAgents - Get array of Agents that match our environment, resource combination
-func (s *SimpleScalar) BuildingAgents() ([]*gocd.Agent, error) {
+func (s *SimpleScalar) BuildingAgents(snapshot *Snapshot) []*gocd.Agent {
 	config := s.config()
-	agents, err := s.client().GetAllAgents()
-	if err == nil {
-		filteredAgents := agents[:0]
-		for _, agent := range agents {
-			if config.matchAgent(agent.Env, agent.Resources) &&
-				(agent.BuildState == "Building") &&
-				(agent.AgentState == "Building") {
-				filteredAgents = append(filteredAgents, agent)
-			}
+	var filteredAgents []*gocd.Agent
+	for _, agent := range snapshot.Agents {
+		if config.matchAgent(agent.Env, agent.Resources) &&
+			(agent.BuildState == "Building") &&
+			(agent.AgentState == "Building") {
+			filteredAgents = append(filteredAgents, agent)
 		}
+	}
+	return filteredAgents
+}
 
-		return filteredAgents, nil
+// executorErr - Error of an executor call. The agents that failed are logged and reported as an
+// executor.AgentsError, unless the call failed as a whole.
+func executorErr(result executor.Result, err error, action string) error {
+	if err != nil {
+		return err
+	}
+	if len(result.Failed) > 0 {
+		logging.Log.Warningf("Couldn't %s %d of %d agents", action, len(result.Failed), len(result.Failed)+len(result.Succeeded))
 	}
-	return []*gocd.Agent{}, err
+	return result.Err(action)
 }
 
 func updateErrors(resultErr *multierror.Error, err error) *multierror.Error {
@@ -1,13 +1,16 @@
 package scalar
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/ashwanthkumar/go-gocd"
 	gocdmocks "github.com/ashwanthkumar/go-gocd/mocks"
 	"github.com/ind9/vasuki/executor"
 	"github.com/ind9/vasuki/utils/logging"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 var (
@@ -20,8 +23,30 @@ func init() {
 	logging.MuteLogs()
 }
 
+// newTestScalar - A SimpleScalar of the test pool on mocks of the GoCD client and the executor. configure,
+// unless nil, tweaks the config of the pool first.
+func newTestScalar(configure func(config *Config)) (*SimpleScalar, *gocdmocks.Client, *executor.MockExecutor) {
+	config := NewConfig(TestEnv, TestResources, TestMaxAgents)
+	if configure != nil {
+		configure(config)
+	}
+	client := new(gocdmocks.Client)
+	mockExecutor := new(executor.MockExecutor)
+	scalar, _ := NewSimpleScalar(config, client, mockExecutor)
+	return scalar.(*SimpleScalar), client, mockExecutor
+}
+
+// snapshotOf - Snapshot with an agent for each of the given ids and no scheduled jobs
+func snapshotOf(agentIDs ...string) *Snapshot {
+	agents := []*gocd.Agent{}
+	for _, agentID := range agentIDs {
+		agents = append(agents, &gocd.Agent{UUID: agentID})
+	}
+	return &Snapshot{Agents: agents}
+}
+
 func TestComputeScaleUp(t *testing.T) {
-	scalar, err := NewSimpleScalar(TestEnv, TestResources, TestMaxAgents, nil)
+	scalar, err := NewSimpleScalar(NewConfig(TestEnv, TestResources, TestMaxAgents), nil, nil)
 	assert.NoError(t, err)
 
 	instances, _ := scalar.ComputeScaleUp(5, 0)
@@ -39,7 +64,7 @@ func TestComputeScaleUp(t *testing.T) {
 }
 
 func TestComputeScaleDown(t *testing.T) {
-	scalar, err := NewSimpleScalar(TestEnv, TestResources, TestMaxAgents, nil)
+	scalar, err := NewSimpleScalar(NewConfig(TestEnv, TestResources, TestMaxAgents), nil, nil)
 	assert.NoError(t, err)
 
 	instances, _ := scalar.ComputeScaleDown(0, 5, 1)
@@ -52,14 +77,16 @@ func TestComputeScaleDown(t *testing.T) {
 
 func TestExecuteForScaleUp(t *testing.T) {
 	mockExecutor := new(executor.MockExecutor)
-	executor.DefaultExecutor = mockExecutor
-	mockExecutor.On("ScaleUp", 1).Return(nil)
+	mockExecutor.On("ScaleUp", 1).Return(executor.Result{Succeeded: []string{"new-agent-1"}}, nil)
 
 	config := NewConfig([]string{"Test-Env"}, []string{"Test-Resource"}, 1)
 	scalar := new(MockScalar)
 	scalar.On("config").Return(config)
-	scalar.On("Demand").Return(1, nil)
-	scalar.On("Supply").Return(0, nil)
+	scalar.On("history").Return(newHistory())
+	scalar.On("Snapshot").Return(&Snapshot{}, nil)
+	scalar.On("executor").Return(mockExecutor)
+	scalar.On("Demand", mock.Anything).Return(1, nil)
+	scalar.On("Supply", mock.Anything).Return(0, nil)
 	scalar.On("ComputeScaleUp", 1, 0).Return(1, nil)
 
 	Execute(scalar)
@@ -68,6 +95,32 @@ func TestExecuteForScaleUp(t *testing.T) {
 	mockExecutor.AssertExpectations(t)
 }
 
+func TestExecuteCountsOnlyTheAgentsThatStarted(t *testing.T) {
+	mockExecutor := new(executor.MockExecutor)
+	mockExecutor.On("ScaleUp", 3).Return(executor.Result{
+		Succeeded: []string{"new-agent-1", "new-agent-2"},
+		Failed:    map[string]error{"new-agent-3": errors.New("no space left on device")},
+	}, nil)
+
+	config := NewConfig([]string{"Test-Env"}, []string{"Test-Resource"}, 3)
+	h := newHistory()
+	scalar := new(MockScalar)
+	scalar.On("config").Return(config)
+	scalar.On("history").Return(h)
+	scalar.On("Snapshot").Return(&Snapshot{}, nil)
+	scalar.On("executor").Return(mockExecutor)
+	scalar.On("Demand", mock.Anything).Return(3, nil)
+	scalar.On("Supply", mock.Anything).Return(0, nil)
+	scalar.On("ComputeScaleUp", 3, 0).Return(3, nil)
+
+	err := Execute(scalar)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "new-agent-3")
+	assert.Equal(t, 2, h.status.ScaledUp)
+	assert.Equal(t, 1, h.status.ScaleUpFailures)
+	assert.Equal(t, "scaled up by 2", h.status.LastAction)
+}
+
 func TestExecuteForScaleDown(t *testing.T) {
 	client := new(gocdmocks.Client)
 	client.On("DisableAgent", "kill-agent-id").Return(nil, nil)
@@ -76,19 +129,29 @@ func TestExecuteForScaleDown(t *testing.T) {
 		BuildState: "Idle",
 	}
 	client.On("GetAgent", "kill-agent-id").Return(agentStatus, nil)
+	client.On("AgentRunJobHistory", "kill-agent-id", 0).Return([]*gocd.JobHistory{{State: "Completed"}}, nil)
 	mockExecutor := new(executor.MockExecutor)
-	executor.DefaultExecutor = mockExecutor
-	mockExecutor.On("ScaleDown", []string{"kill-agent-id"}).Return(nil)
+	mockExecutor.On("ScaleDown", []string{"kill-agent-id"}).Return(executor.Result{Succeeded: []string{"kill-agent-id"}}, nil)
 
 	config := NewConfig([]string{"Test-Env"}, []string{"Test-Resource"}, 1)
 	scalar := new(MockScalar)
 	scalar.On("config").Return(config)
+	scalar.On("history").Return(newHistory())
+	scalar.On("Snapshot").Return(&Snapshot{}, nil)
+	scalar.On("executor").Return(mockExecutor)
 	scalar.On("client").Return(client)
-	scalar.On("Demand").Return(0, nil)
-	scalar.On("Supply").Return(1, nil)
+	scalar.On("Demand", mock.Anything).Return(0, nil)
+	scalar.On("Supply", mock.Anything).Return(1, nil).Once()
+	scalar.On("Supply", mock.Anything).Return(0, nil).Once()
 	scalar.On("ComputeScaleDown", 0, 1, 1).Return(1, nil)
-	scalar.On("IdleAgents").Return([]string{"kill-agent-id"}, nil)
+	scalar.On("IdleAgents", mock.Anything).Return([]string{"kill-agent-id"}, nil)
 
+	// The agent is only disabled on the first tick
+	Execute(scalar)
+	client.AssertNotCalled(t, "DeleteAgent", "kill-agent-id")
+	mockExecutor.AssertNotCalled(t, "ScaleDown", []string{"kill-agent-id"})
+
+	// and removed on the next one, as it wasn't assigned a job in the meantime
 	Execute(scalar)
 
 	client.AssertExpectations(t)
@@ -105,17 +168,20 @@ func TestSkipScaleDownIfAgentFoundBuildingAfterDisabling(t *testing.T) {
 	}
 	client.On("GetAgent", "kill-agent-id").Return(agentStatus, nil)
 	mockExecutor := new(executor.MockExecutor)
-	executor.DefaultExecutor = mockExecutor
 
 	config := NewConfig([]string{"Test-Env"}, []string{"Test-Resource"}, 1)
 	scalar := new(MockScalar)
 	scalar.On("config").Return(config)
+	scalar.On("history").Return(newHistory())
+	scalar.On("Snapshot").Return(&Snapshot{}, nil)
 	scalar.On("client").Return(client)
-	scalar.On("Demand").Return(0, nil)
-	scalar.On("Supply").Return(1, nil)
+	scalar.On("Demand", mock.Anything).Return(0, nil).Once()
+	scalar.On("Demand", mock.Anything).Return(1, nil).Once()
+	scalar.On("Supply", mock.Anything).Return(1, nil)
 	scalar.On("ComputeScaleDown", 0, 1, 1).Return(1, nil)
-	scalar.On("IdleAgents").Return([]string{"kill-agent-id"}, nil)
+	scalar.On("IdleAgents", mock.Anything).Return([]string{"kill-agent-id"}, nil)
 
+	Execute(scalar)
 	Execute(scalar)
 
 	client.AssertExpectations(t)
@@ -124,3 +190,265 @@ func TestSkipScaleDownIfAgentFoundBuildingAfterDisabling(t *testing.T) {
 	mockExecutor.AssertNotCalled(t, "ScaleDown", []string{"kill-agent-id"})
 	client.AssertNotCalled(t, "DeleteAgent", "kill-agent-id")
 }
+
+func TestSkipScaleDownIfAgentWasAssignedAJobAfterDisabling(t *testing.T) {
+	client := new(gocdmocks.Client)
+	client.On("DisableAgent", "kill-agent-id").Return(nil, nil)
+	client.On("EnableAgent", "kill-agent-id").Return(nil, nil)
+	// The agents API still reports the agent as idle, but the job history knows better
+	client.On("GetAgent", "kill-agent-id").Return(&gocd.Agent{BuildState: "Idle"}, nil)
+	client.On("AgentRunJobHistory", "kill-agent-id", 0).Return([]*gocd.JobHistory{{State: "Assigned"}, {State: "Completed"}}, nil)
+
+	config := NewConfig([]string{"Test-Env"}, []string{"Test-Resource"}, 1)
+	scalar := new(MockScalar)
+	scalar.On("config").Return(config)
+	scalar.On("history").Return(newHistory())
+	scalar.On("Snapshot").Return(&Snapshot{}, nil)
+	scalar.On("client").Return(client)
+	scalar.On("Demand", mock.Anything).Return(0, nil).Once()
+	scalar.On("Demand", mock.Anything).Return(1, nil).Once()
+	scalar.On("Supply", mock.Anything).Return(1, nil)
+	scalar.On("ComputeScaleDown", 0, 1, 1).Return(1, nil)
+	scalar.On("IdleAgents", mock.Anything).Return([]string{"kill-agent-id"}, nil)
+
+	Execute(scalar)
+	Execute(scalar)
+
+	client.AssertExpectations(t)
+	client.AssertNotCalled(t, "DeleteAgent", "kill-agent-id")
+}
+
+func TestFinishScaleDownIgnoresTheJobsThatLeftTheAgent(t *testing.T) {
+	scalar, client, mockExecutor := newTestScalar(nil)
+	scalar.history().pendingScaleDown["kill-agent-id"] = time.Now()
+	client.On("GetAgent", "kill-agent-id").Return(&gocd.Agent{BuildState: "Idle"}, nil)
+	client.On("AgentRunJobHistory", "kill-agent-id", 0).Return([]*gocd.JobHistory{{State: "Rescheduled"}, {State: "Discontinued"}, {State: "Completed"}}, nil)
+	client.On("DeleteAgent", "kill-agent-id").Return(nil)
+	mockExecutor.On("ScaleDown", []string{"kill-agent-id"}).Return(executor.Result{Succeeded: []string{"kill-agent-id"}}, nil)
+
+	assert.NoError(t, finishScaleDown(scalar))
+	assert.Empty(t, scalar.history().pendingScaleDown)
+	client.AssertNotCalled(t, "EnableAgent", "kill-agent-id")
+	mockExecutor.AssertExpectations(t)
+}
+
+func TestFinishScaleDownOnlyKillsTheAgentsThatAreGone(t *testing.T) {
+	scalar, client, mockExecutor := newTestScalar(nil)
+	scalar.history().pendingScaleDown["deleted-agent"] = time.Now()
+	scalar.history().pendingScaleDown["unknown-agent"] = time.Now()
+	client.On("GetAgent", "deleted-agent").Return(nil, errors.New("404 Not Found"))
+	client.On("GetAgent", "unknown-agent").Return(&gocd.Agent{}, nil)
+	mockExecutor.On("ScaleDown", []string{"deleted-agent", "unknown-agent"}).Return(executor.Result{Succeeded: []string{"deleted-agent", "unknown-agent"}}, nil)
+
+	assert.NoError(t, finishScaleDown(scalar))
+	assert.Empty(t, scalar.history().pendingScaleDown)
+	client.AssertNotCalled(t, "DeleteAgent", mock.Anything)
+	mockExecutor.AssertExpectations(t)
+}
+
+func TestCancelScaleDownEnablesTheDisabledAgentsBack(t *testing.T) {
+	client := new(gocdmocks.Client)
+	client.On("EnableAgent", "kill-agent-id").Return(nil)
+	history := newHistory()
+	history.pendingScaleDown["kill-agent-id"] = time.Now()
+	scalar := new(MockScalar)
+	scalar.On("history").Return(history)
+	scalar.On("Snapshot").Return(&Snapshot{}, nil)
+	scalar.On("client").Return(client)
+
+	assert.NoError(t, CancelScaleDown(scalar))
+	client.AssertExpectations(t)
+	assert.Empty(t, history.pendingScaleDown)
+}
+
+func TestExecuteScalesUpToTheWarmPool(t *testing.T) {
+	mockExecutor := new(executor.MockExecutor)
+	mockExecutor.On("ScaleUp", 1).Return(executor.Result{Succeeded: []string{"new-agent-1"}}, nil)
+
+	config := NewConfig([]string{"Test-Env"}, []string{"Test-Resource"}, 3)
+	config.MinAgents = 2
+	scalar := new(MockScalar)
+	scalar.On("config").Return(config)
+	scalar.On("history").Return(newHistory())
+	scalar.On("Snapshot").Return(&Snapshot{}, nil)
+	scalar.On("executor").Return(mockExecutor)
+	scalar.On("Demand", mock.Anything).Return(0, nil)
+	scalar.On("Supply", mock.Anything).Return(0, nil)
+	scalar.On("ComputeScaleUp", 2, 0).Return(1, nil)
+
+	Execute(scalar)
+
+	scalar.AssertExpectations(t)
+	mockExecutor.AssertExpectations(t)
+}
+
+func TestExecuteNeverScalesDownBelowTheWarmPool(t *testing.T) {
+	config := NewConfig([]string{"Test-Env"}, []string{"Test-Resource"}, 3)
+	config.MinAgents = 2
+	scalar := new(MockScalar)
+	scalar.On("config").Return(config)
+	scalar.On("history").Return(newHistory())
+	scalar.On("Snapshot").Return(&Snapshot{}, nil)
+	scalar.On("Demand", mock.Anything).Return(0, nil)
+	scalar.On("Supply", mock.Anything).Return(2, nil)
+
+	Execute(scalar)
+
+	scalar.AssertExpectations(t)
+	scalar.AssertNotCalled(t, "ComputeScaleDown", 2, 2, 2)
+	scalar.AssertNotCalled(t, "IdleAgents")
+}
+
+func TestComputeScaleDownKeepsTheWarmPool(t *testing.T) {
+	config := NewConfig(TestEnv, TestResources, TestMaxAgents)
+	config.MinAgents = 2
+	scalar, err := NewSimpleScalar(config, nil, nil)
+	assert.NoError(t, err)
+
+	instances, _ := scalar.ComputeScaleDown(config.wanted(0), 3, 3)
+	assert.Equal(t, 1, instances)
+}
+
+func TestExecuteSkipsScaleUpWithinCooldown(t *testing.T) {
+	mockExecutor := new(executor.MockExecutor)
+
+	config := NewConfig([]string{"Test-Env"}, []string{"Test-Resource"}, 3)
+	config.ScaleUpCooldown = time.Minute
+	history := newHistory()
+	history.lastScaleUp = time.Now()
+	scalar := new(MockScalar)
+	scalar.On("config").Return(config)
+	scalar.On("history").Return(history)
+	scalar.On("Snapshot").Return(&Snapshot{}, nil)
+	scalar.On("Demand", mock.Anything).Return(1, nil)
+	scalar.On("Supply", mock.Anything).Return(0, nil)
+	scalar.On("ComputeScaleUp", 1, 0).Return(1, nil)
+
+	Execute(scalar)
+
+	scalar.AssertExpectations(t)
+	mockExecutor.AssertNotCalled(t, "ScaleUp", 1)
+}
+
+func TestExecuteRetriesAFailedScaleUpDespiteTheCooldown(t *testing.T) {
+	mockExecutor := new(executor.MockExecutor)
+	mockExecutor.On("ScaleUp", 1).Return(executor.Result{}, errors.New("docker daemon is down")).Once()
+	mockExecutor.On("ScaleUp", 1).Return(executor.Result{Succeeded: []string{"new-agent-1"}}, nil).Once()
+
+	config := NewConfig([]string{"Test-Env"}, []string{"Test-Resource"}, 3)
+	config.ScaleUpCooldown = time.Minute
+	history := newHistory()
+	scalar := new(MockScalar)
+	scalar.On("config").Return(config)
+	scalar.On("history").Return(history)
+	scalar.On("Snapshot").Return(&Snapshot{}, nil)
+	scalar.On("executor").Return(mockExecutor)
+	scalar.On("Demand", mock.Anything).Return(1, nil)
+	scalar.On("Supply", mock.Anything).Return(0, nil)
+	scalar.On("ComputeScaleUp", 1, 0).Return(1, nil)
+
+	assert.Error(t, Execute(scalar))
+	assert.True(t, history.lastScaleUp.IsZero())
+	assert.NoError(t, Execute(scalar))
+	assert.False(t, history.lastScaleUp.IsZero())
+
+	mockExecutor.AssertExpectations(t)
+}
+
+func TestExecuteOnlyScalesDownAgentsIdleForMinIdleTime(t *testing.T) {
+	client := new(gocdmocks.Client)
+	client.On("DisableAgent", "old-agent-id").Return(nil)
+
+	config := NewConfig([]string{"Test-Env"}, []string{"Test-Resource"}, 3)
+	config.MinIdleTime = 5 * time.Minute
+	history := newHistory()
+	history.idleSince["old-agent-id"] = time.Now().Add(-10 * time.Minute)
+	scalar := new(MockScalar)
+	scalar.On("config").Return(config)
+	scalar.On("history").Return(history)
+	scalar.On("Snapshot").Return(&Snapshot{}, nil)
+	scalar.On("client").Return(client)
+	scalar.On("Demand", mock.Anything).Return(0, nil)
+	scalar.On("Supply", mock.Anything).Return(2, nil)
+	scalar.On("IdleAgents", mock.Anything).Return([]string{"new-agent-id", "old-agent-id"}, nil)
+	scalar.On("ComputeScaleDown", 0, 2, 1).Return(1, nil)
+
+	Execute(scalar)
+
+	scalar.AssertExpectations(t)
+	client.AssertExpectations(t)
+	client.AssertNotCalled(t, "DisableAgent", "new-agent-id")
+	assert.Contains(t, history.idleSince, "new-agent-id")
+	assert.Contains(t, history.pendingScaleDown, "old-agent-id")
+}
+
+func TestExecuteRecordsTheStatusOfTheScalar(t *testing.T) {
+	mockExecutor := new(executor.MockExecutor)
+	mockExecutor.On("ScaleUp", 2).Return(executor.Result{Succeeded: []string{"new-agent-1", "new-agent-2"}}, nil)
+
+	config := NewConfig([]string{"Test-Env"}, []string{"Test-Resource"}, 3)
+	h := newHistory()
+	scalar := new(MockScalar)
+	scalar.On("config").Return(config)
+	scalar.On("history").Return(h)
+	scalar.On("Snapshot").Return(&Snapshot{}, nil)
+	scalar.On("executor").Return(mockExecutor)
+	scalar.On("Demand", mock.Anything).Return(3, nil)
+	scalar.On("Supply", mock.Anything).Return(1, nil)
+	scalar.On("ComputeScaleUp", 3, 1).Return(2, nil)
+
+	assert.NoError(t, Execute(scalar))
+
+	status := CurrentStatus(scalar)
+	assert.Equal(t, 3, status.Demand)
+	assert.Equal(t, 1, status.Supply)
+	assert.Equal(t, "scaled up by 2", status.LastAction)
+	assert.Equal(t, 2, status.ScaledUp)
+	assert.Equal(t, 0, status.ScaleUpFailures)
+	assert.False(t, status.LastActionAt.IsZero())
+}
+
+func TestDryRunPlansTheScaleUpWithoutStartingAgents(t *testing.T) {
+	mockExecutor := new(executor.MockExecutor)
+
+	config := NewConfig([]string{"Test-Env"}, []string{"Test-Resource"}, 3)
+	config.DryRun = true
+	scalar := new(MockScalar)
+	scalar.On("config").Return(config)
+	scalar.On("history").Return(newHistory())
+	scalar.On("Snapshot").Return(&Snapshot{}, nil)
+	scalar.On("executor").Return(mockExecutor)
+	scalar.On("Demand", mock.Anything).Return(2, nil)
+	scalar.On("Supply", mock.Anything).Return(0, nil)
+	scalar.On("ComputeScaleUp", 2, 0).Return(2, nil)
+
+	assert.NoError(t, Execute(scalar))
+
+	mockExecutor.AssertNotCalled(t, "ScaleUp", 2)
+	assert.Equal(t, &Plan{ScaleUp: 2}, CurrentStatus(scalar).Plan)
+}
+
+func TestDryRunPlansTheScaleDownWithoutTouchingAgents(t *testing.T) {
+	client := new(gocdmocks.Client)
+	mockExecutor := new(executor.MockExecutor)
+
+	config := NewConfig([]string{"Test-Env"}, []string{"Test-Resource"}, 1)
+	config.DryRun = true
+	scalar := new(MockScalar)
+	scalar.On("config").Return(config)
+	scalar.On("history").Return(newHistory())
+	scalar.On("Snapshot").Return(&Snapshot{}, nil)
+	scalar.On("executor").Return(mockExecutor)
+	scalar.On("client").Return(client)
+	scalar.On("Demand", mock.Anything).Return(0, nil)
+	scalar.On("Supply", mock.Anything).Return(1, nil)
+	scalar.On("ComputeScaleDown", 0, 1, 1).Return(1, nil)
+	scalar.On("IdleAgents", mock.Anything).Return([]string{"kill-agent-id"}, nil)
+
+	assert.NoError(t, Execute(scalar))
+
+	client.AssertNotCalled(t, "DisableAgent", "kill-agent-id")
+	client.AssertNotCalled(t, "DeleteAgent", "kill-agent-id")
+	mockExecutor.AssertNotCalled(t, "ScaleDown", []string{"kill-agent-id"})
+	assert.Equal(t, []string{"kill-agent-id"}, CurrentStatus(scalar).Plan.ScaleDown)
+}
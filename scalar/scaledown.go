@@ -0,0 +1,151 @@
+package scalar
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ashwanthkumar/go-gocd"
+	"github.com/hashicorp/go-multierror"
+	"github.com/ind9/vasuki/utils/logging"
+)
+
+// finishScaleDown - Second phase of a scale down. The agents that were disabled on an earlier tick
+// are deleted and killed, unless GoCD assigned them a job before it noticed they were disabled. Those
+// are enabled back instead, or in ephemeral mode kept disabled until they're done with the job. Agents
+// that are gone from the GoCD Server are only killed, the ones whose state couldn't be checked are
+// retried on the next tick.
+func finishScaleDown(s Scalar) error {
+	config := s.config()
+	history := s.history()
+	var resultErr *multierror.Error
+	var agentsToKill []string
+	for _, agentID := range history.pendingScaleDownAgents() {
+		busy, err := hasWork(s, agentID)
+		if err == errAgentGone {
+			logging.Log.Infof("The disabled agent %s is gone from the Go Server, it's only killed", agentID)
+			agentsToKill = append(agentsToKill, agentID)
+			history.forgetScaleDown(agentID)
+			continue
+		}
+		if err != nil {
+			resultErr = updateErrors(resultErr, err)
+			continue
+		}
+
+		if busy && config.Ephemeral {
+			logging.Log.Debugf("Agent %s is still running its job, it's removed once that's done", agentID)
+			continue
+		}
+		if busy {
+			logging.Log.Noticef("Agent %s was assigned a job after it was disabled, enabling it back", agentID)
+			err = s.client().EnableAgent(agentID)
+		} else {
+			logging.Log.Infof("Deleting the disabled agent %s on Go Server", agentID)
+			err = s.client().DeleteAgent(agentID)
+			if err == nil {
+				agentsToKill = append(agentsToKill, agentID)
+			}
+		}
+		resultErr = updateErrors(resultErr, err)
+		if err == nil {
+			history.forgetScaleDown(agentID)
+		}
+	}
+
+	if len(agentsToKill) > 0 {
+		result, err := s.executor().ScaleDown(agentsToKill)
+		history.scaledDown(result, err)
+		// Agents that are gone from the Go Server but still running are left to the garbage collector
+		resultErr = updateErrors(resultErr, executorErr(result, err, "kill"))
+		if len(result.Succeeded) > 0 {
+			history.recordAction(fmt.Sprintf("scaled down by %d", len(result.Succeeded)), now())
+		}
+	}
+	return resultErr.ErrorOrNil()
+}
+
+// CancelScaleDown - Enables back the agents that were disabled for a scale down that hasn't finished
+// yet, so they aren't left disabled when the Scalar stops. Agents that ran their job in ephemeral mode
+// are left disabled, they mustn't take another one.
+func CancelScaleDown(s Scalar) error {
+	history := s.history()
+	var resultErr *multierror.Error
+	for _, agentID := range history.pendingScaleDownAgents() {
+		if history.retired.Contains(agentID) {
+			logging.Log.Infof("Leaving the agent %s disabled as it already ran its job", agentID)
+			continue
+		}
+		logging.Log.Infof("Enabling back the agent %s that was disabled to scale down", agentID)
+		err := s.client().EnableAgent(agentID)
+		resultErr = updateErrors(resultErr, err)
+		if err == nil {
+			history.forgetScaleDown(agentID)
+		}
+	}
+	return resultErr.ErrorOrNil()
+}
+
+// errAgentGone - The agent was deleted from the GoCD Server by someone else, there's nothing left to wait for
+var errAgentGone = errors.New("agent is gone from the Go Server")
+
+// activeJobStates - States of a job in the job history while it's on the agent. Rescheduled and
+// Discontinued jobs stay in the history for good, but they no longer keep the agent busy.
+var activeJobStates = map[string]bool{
+	"Assigned":   true,
+	"Preparing":  true,
+	"Building":   true,
+	"Completing": true,
+}
+
+// hasWork - If the agent is building, or its job history has a job that was assigned to it but isn't
+// done yet. The agents API alone lags behind the job assignment, see the Known Issue in the README.
+// Returns errAgentGone when the agent is no longer on the GoCD Server.
+func hasWork(s Scalar, agentID string) (bool, error) {
+	agent, err := s.client().GetAgent(agentID)
+	if isAgentGone(agent, err) {
+		return false, errAgentGone
+	}
+	if err != nil {
+		return false, err
+	}
+	if agent.BuildState == "Building" {
+		return true, nil
+	}
+	jobs, err := s.client().AgentRunJobHistory(agentID, 0)
+	if err != nil {
+		return false, err
+	}
+	for _, job := range jobs {
+		if activeJobStates[job.State] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// isAgentGone - If GoCD answered 404 for the agent. Depending on the version of the client that's either
+// an error, or an agent decoded from the error message that has none of its fields.
+func isAgentGone(agent *gocd.Agent, err error) bool {
+	if err != nil {
+		return strings.Contains(err.Error(), "404")
+	}
+	return agent == nil || (agent.UUID == "" && agent.AgentState == "" && agent.BuildState == "")
+}
+
+// forgetScaleDown - The agent was removed or enabled back, it's no longer pending
+func (h *history) forgetScaleDown(agentID string) {
+	delete(h.pendingScaleDown, agentID)
+	h.retired.Remove(agentID)
+}
+
+// pendingScaleDownAgents - Agents that were disabled to scale down, in a stable order
+func (h *history) pendingScaleDownAgents() []string {
+	agents := make([]string, 0, len(h.pendingScaleDown))
+	for agentID := range h.pendingScaleDown {
+		agents = append(agents, agentID)
+	}
+	sort.Strings(agents)
+	return agents
+}
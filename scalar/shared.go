@@ -0,0 +1,43 @@
+package scalar
+
+import "sync"
+
+// SharedMaxAgents - Max agents shared by the Scalars of the profiles of a pool, on top of the max agents of
+// each of them. The Scalars run on their own, so the agents they start are claimed under a lock.
+type SharedMaxAgents struct {
+	Max    int
+	mutex  sync.Mutex
+	supply map[*Config]int // Supply of each Scalar as of its last tick, including the agents it claimed
+}
+
+// NewSharedMaxAgents - Creates a new scalar.SharedMaxAgents instance
+func NewSharedMaxAgents(max int) *SharedMaxAgents {
+	return &SharedMaxAgents{Max: max, supply: make(map[*Config]int)}
+}
+
+// observe - Records the supply of the Scalar with the config
+func (m *SharedMaxAgents) observe(config *Config, supply int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.supply[config] = supply
+}
+
+// claim - # of the instances the Scalar with the config can start without the profiles going over the max
+func (m *SharedMaxAgents) claim(config *Config, supply int, instances int) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	available := m.Max - supply
+	for other, otherSupply := range m.supply {
+		if other != config {
+			available -= otherSupply
+		}
+	}
+	if instances > available {
+		instances = available
+	}
+	if instances < 0 {
+		instances = 0
+	}
+	m.supply[config] = supply + instances
+	return instances
+}
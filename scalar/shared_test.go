@@ -0,0 +1,43 @@
+package scalar
+
+import (
+	"testing"
+
+	"github.com/ind9/vasuki/executor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSharedMaxAgentsIsSplitAcrossTheProfiles(t *testing.T) {
+	shared := NewSharedMaxAgents(5)
+	selenium := NewConfig(TestEnv, []string{"chrome"}, 5)
+	jdk11 := NewConfig(TestEnv, []string{"jdk11"}, 5)
+
+	shared.observe(jdk11, 1)
+	assert.Equal(t, 3, shared.claim(selenium, 1, 4))
+	assert.Equal(t, 0, shared.claim(jdk11, 1, 2))
+
+	// Agents the other profile scaled down are available again
+	shared.observe(selenium, 2)
+	assert.Equal(t, 2, shared.claim(jdk11, 1, 2))
+}
+
+func TestExecuteScalesUpWithinTheMaxAgentsSharedByTheProfiles(t *testing.T) {
+	mockExecutor := new(executor.MockExecutor)
+	mockExecutor.On("ScaleUp", 1).Return(executor.Result{Succeeded: []string{"new-agent-1"}}, nil)
+
+	config := NewConfig(TestEnv, []string{"chrome"}, 5)
+	config.Shared = NewSharedMaxAgents(3)
+	config.Shared.observe(NewConfig(TestEnv, []string{"jdk11"}, 5), 2)
+	scalar := new(MockScalar)
+	scalar.On("config").Return(config)
+	scalar.On("history").Return(newHistory())
+	scalar.On("Snapshot").Return(&Snapshot{}, nil)
+	scalar.On("executor").Return(mockExecutor)
+	scalar.On("Demand", mock.Anything).Return(4, nil)
+	scalar.On("Supply", mock.Anything).Return(0, nil)
+	scalar.On("ComputeScaleUp", 4, 0).Return(4, nil)
+
+	assert.NoError(t, Execute(scalar))
+	mockExecutor.AssertExpectations(t)
+}
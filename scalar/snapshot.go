@@ -0,0 +1,36 @@
+package scalar
+
+import (
+	"github.com/ashwanthkumar/go-gocd"
+	"github.com/ind9/vasuki/utils/sets"
+)
+
+// Snapshot - State of the GoCD Server as of the start of a tick. Demand, supply and idle agents are
+// all computed from the same snapshot, so they're consistent with each other and the server is only
+// asked once per tick.
+type Snapshot struct {
+	Agents        []*gocd.Agent
+	ScheduledJobs []*gocd.ScheduledJob
+}
+
+// TakeSnapshot - Reads the agents and the scheduled jobs of the GoCD Server
+func TakeSnapshot(client gocd.Client) (*Snapshot, error) {
+	agents, err := client.GetAllAgents()
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := client.GetScheduledJobs()
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{Agents: agents, ScheduledJobs: jobs}, nil
+}
+
+// registered - UUIDs of every agent registered with the GoCD Server, whatever its env / resources
+func (s *Snapshot) registered() sets.Set {
+	registered := sets.Empty()
+	for _, agent := range s.Agents {
+		registered.Add(agent.UUID)
+	}
+	return registered
+}
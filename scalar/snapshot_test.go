@@ -0,0 +1,48 @@
+package scalar
+
+import (
+	"testing"
+
+	"github.com/ashwanthkumar/go-gocd"
+	gocdmocks "github.com/ashwanthkumar/go-gocd/mocks"
+	"github.com/ind9/vasuki/executor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteReadsTheGoCDServerOncePerTick(t *testing.T) {
+	client := new(gocdmocks.Client)
+	client.On("GetAllAgents").Return([]*gocd.Agent{
+		{UUID: "building-agent", BuildState: "Building", AgentState: "Building"},
+		{UUID: "idle-agent", BuildState: "Idle", AgentState: "Idle"},
+	}, nil).Once()
+	client.On("GetScheduledJobs").Return([]*gocd.ScheduledJob{{}, {}}, nil).Once()
+	mockExecutor := new(executor.MockExecutor)
+	mockExecutor.On("ManagedAgents").Return([]string{"building-agent", "idle-agent"}, nil)
+	mockExecutor.On("ScaleUp", 1).Return(executor.Result{Succeeded: []string{"new-agent-1"}}, nil)
+
+	config := NewConfig([]string{}, []string{}, 4)
+	config.Policy = &AllAtOnce{}
+	scalar, _ := NewSimpleScalar(config, client, mockExecutor)
+
+	assert.NoError(t, Execute(scalar))
+	client.AssertExpectations(t)
+	mockExecutor.AssertExpectations(t)
+	status := CurrentStatus(scalar)
+	assert.Equal(t, 2, status.Queued)
+	assert.Equal(t, 1, status.Building)
+	assert.Equal(t, 2, status.Supply)
+}
+
+func TestSnapshotFiltersDoNotChangeTheSnapshot(t *testing.T) {
+	snapshot := &Snapshot{
+		Agents: []*gocd.Agent{
+			{UUID: "other-agent", Env: []string{"UAT"}, BuildState: "Building", AgentState: "Building"},
+			{UUID: "our-agent", BuildState: "Building", AgentState: "Building"},
+		},
+	}
+	scalar, _ := NewSimpleScalar(NewConfig([]string{}, []string{}, 1), nil, nil)
+
+	building := scalar.(*SimpleScalar).BuildingAgents(snapshot)
+	assert.Len(t, building, 1)
+	assert.Equal(t, "other-agent", snapshot.Agents[0].UUID)
+}
@@ -0,0 +1,38 @@
+package backoff
+
+import "time"
+
+// Exponential - Delay between retries that doubles on every attempt
+type Exponential struct {
+	Initial  time.Duration
+	Max      time.Duration
+	attempts uint
+}
+
+// Next delay to wait for before retrying, counts as an attempt
+func (b *Exponential) Next() time.Duration {
+	max := b.Max
+	if max < b.Initial {
+		max = b.Initial
+	}
+
+	delay := b.Initial
+	for attempt := uint(0); attempt < b.attempts && delay < max; attempt++ {
+		delay = delay * 2
+	}
+	if delay > max {
+		delay = max
+	}
+	b.attempts++
+	return delay
+}
+
+// Attempts made since the last Reset
+func (b *Exponential) Attempts() int {
+	return int(b.attempts)
+}
+
+// Reset the delay back to Initial
+func (b *Exponential) Reset() {
+	b.attempts = 0
+}
@@ -0,0 +1,36 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextDoublesTheDelayUptoMax(t *testing.T) {
+	b := &Exponential{Initial: time.Second, Max: 5 * time.Second}
+
+	assert.Equal(t, time.Second, b.Next())
+	assert.Equal(t, 2*time.Second, b.Next())
+	assert.Equal(t, 4*time.Second, b.Next())
+	assert.Equal(t, 5*time.Second, b.Next())
+	assert.Equal(t, 5*time.Second, b.Next())
+	assert.Equal(t, 5, b.Attempts())
+}
+
+func TestResetStartsOverFromInitial(t *testing.T) {
+	b := &Exponential{Initial: time.Second, Max: time.Minute}
+	b.Next()
+	b.Next()
+
+	b.Reset()
+	assert.Equal(t, 0, b.Attempts())
+	assert.Equal(t, time.Second, b.Next())
+}
+
+func TestMaxIsNeverLessThanInitial(t *testing.T) {
+	b := &Exponential{Initial: time.Minute, Max: time.Second}
+
+	assert.Equal(t, time.Minute, b.Next())
+	assert.Equal(t, time.Minute, b.Next())
+}
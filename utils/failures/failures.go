@@ -0,0 +1,39 @@
+package failures
+
+// fatal - Error that retrying won't fix, like an invalid configuration
+type fatal struct {
+	err error
+}
+
+func (f *fatal) Error() string {
+	return f.err.Error()
+}
+
+// Fatal - Marks the error as fatal, nil stays nil
+func Fatal(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &fatal{err: err}
+}
+
+// wrapper - Error made of other errors, like a multierror.Error
+type wrapper interface {
+	WrappedErrors() []error
+}
+
+// IsFatal - Checks if the error, or any of the errors it's made of, is fatal.
+// Errors are transient unless they're marked via Fatal.
+func IsFatal(err error) bool {
+	switch e := err.(type) {
+	case *fatal:
+		return true
+	case wrapper:
+		for _, wrapped := range e.WrappedErrors() {
+			if IsFatal(wrapped) {
+				return true
+			}
+		}
+	}
+	return false
+}
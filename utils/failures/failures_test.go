@@ -0,0 +1,28 @@
+package failures
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorsAreTransientByDefault(t *testing.T) {
+	assert.False(t, IsFatal(errors.New("connection refused")))
+	assert.False(t, IsFatal(nil))
+}
+
+func TestFatalErrors(t *testing.T) {
+	err := Fatal(errors.New("invalid image"))
+
+	assert.True(t, IsFatal(err))
+	assert.Equal(t, "invalid image", err.Error())
+	assert.Nil(t, Fatal(nil))
+}
+
+func TestFatalErrorWithinMultiError(t *testing.T) {
+	err := multierror.Append(errors.New("connection refused"), Fatal(errors.New("forbidden")))
+
+	assert.True(t, IsFatal(err))
+}
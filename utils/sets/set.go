@@ -4,6 +4,7 @@ package sets
 type Set interface {
 	Contains(elem string) bool
 	Add(elem string)
+	Remove(elem string)
 	Union(another Set) Set
 	Intersect(another Set) Set
 	IsSupersetOf(another Set) bool
@@ -45,6 +46,11 @@ func (s *MapSet) Add(elem string) {
 	s._data[elem] = nil
 }
 
+// Remove an element from the Set
+func (s *MapSet) Remove(elem string) {
+	delete(s._data, elem)
+}
+
 // Union another Set to this set and returns that
 func (s *MapSet) Union(another Set) Set {
 	union := FromSlice(s.Values())
@@ -96,3 +96,10 @@ func TestSetEqual(t *testing.T) {
 	assert.True(t, set1.Equal(set2))
 	assert.True(t, Empty().Equal(Empty()))
 }
+
+func TestSetRemove(t *testing.T) {
+	set := FromSlice([]string{"1", "2"})
+	set.Remove("1")
+	set.Remove("3")
+	assert.Equal(t, []string{"2"}, set.Values())
+}